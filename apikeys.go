@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tepidmilk/gator/internal/database"
+)
+
+// Prefix of every API key, so leaked keys are easy to spot. Only a key's
+// hash is stored, so it can't be shown again once it's been handed out.
+const apiKeyPrefix = "gator_"
+
+// Create an API key for the serve API and print it
+func handlerAddKey(s *state, cmd command, user database.User) error {
+	name := ""
+	if len(cmd.args) > 0 {
+		name = cmd.args[0]
+	}
+	key, err := randomToken(apiKeyPrefix)
+	if err != nil {
+		return fmt.Errorf("error generating API key: %v", err)
+	}
+	apiKey, err := s.db.CreateAPIKey(context.Background(), database.CreateAPIKeyParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		Name:      name,
+		KeyHash:   hashToken(key),
+	})
+	if err != nil {
+		return fmt.Errorf("error creating API key: %v", err)
+	}
+
+	fmt.Printf("Created API key [%s] for %s. It won't be shown again:\n", shortID(apiKey.ID), user.Name)
+	fmt.Println(key)
+	return nil
+}
+
+// List the current user's API keys
+func handlerKeys(s *state, cmd command, user database.User) error {
+	keys, err := s.db.GetAPIKeysForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("error getting API keys: %v", err)
+	}
+	if s.output != "" {
+		records := make([]apiKeyRecord, 0, len(keys))
+		for _, key := range keys {
+			records = append(records, apiKeyRecord{
+				ID:         key.ID,
+				Name:       key.Name,
+				CreatedAt:  key.CreatedAt,
+				LastUsedAt: timeOrNil(key.LastUsedAt.Time, key.LastUsedAt.Valid),
+				RevokedAt:  timeOrNil(key.RevokedAt.Time, key.RevokedAt.Valid),
+			})
+		}
+		return writeRecords(os.Stdout, s.output, records)
+	}
+	for _, key := range keys {
+		fmt.Printf(" - [%s] %s created %s", shortID(key.ID), key.Name, key.CreatedAt.Format("Mon Jan 2 2006"))
+		if key.LastUsedAt.Valid {
+			fmt.Printf(", last used %s", key.LastUsedAt.Time.Format(time.RFC1123))
+		} else {
+			fmt.Print(", never used")
+		}
+		if key.RevokedAt.Valid {
+			fmt.Print(" (revoked)")
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// Revoke one of the current user's API keys given (a prefix of) its ID
+func handlerRevokeKey(s *state, cmd command, user database.User) error {
+	// an empty prefix would match every key
+	if strings.TrimSpace(cmd.args[0]) == "" {
+		return errors.New("no API key given")
+	}
+	keys, err := s.db.GetAPIKeysForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("error getting API keys: %v", err)
+	}
+	var matches []database.ApiKey
+	for _, key := range keys {
+		if strings.HasPrefix(key.ID.String(), cmd.args[0]) {
+			matches = append(matches, key)
+		}
+	}
+	switch {
+	case len(matches) == 0:
+		return fmt.Errorf("no API key matches '%s'", cmd.args[0])
+	case len(matches) > 1:
+		return fmt.Errorf("'%s' matches more than one API key", cmd.args[0])
+	}
+
+	revoked, err := s.db.RevokeAPIKey(context.Background(), database.RevokeAPIKeyParams{
+		RevokedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:        matches[0].ID,
+		UserID:    user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("error revoking API key: %v", err)
+	} else if revoked == 0 {
+		return fmt.Errorf("API key [%s] is already revoked", shortID(matches[0].ID))
+	}
+	fmt.Printf("Revoked API key [%s]\n", shortID(matches[0].ID))
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tepidmilk/gator/internal/database"
+	"github.com/tepidmilk/gator/internal/htmltext"
+	"github.com/tepidmilk/gator/internal/readability"
+)
+
+// Largest page we'll download when extracting an article
+const maxArticlePageSize = 5 << 20
+
+// Articles agg extracts per pass of the queue, and how long it waits
+// between passes
+const (
+	articleQueueBatch    = 10
+	articleQueueInterval = time.Minute
+)
+
+// Download the page a post links to and store its main article for reading
+// offline in browse
+func handlerFetchArticle(s *state, cmd command) error {
+	post, err := resolvePost(s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	article, err := fetchArticle(context.Background(), s, post)
+	if err != nil {
+		return fmt.Errorf("error fetching article: %v", err)
+	}
+
+	fmt.Printf("Saved article for '%s' (%d words)\n", htmltext.StripControl(post.Title), len(strings.Fields(htmltext.Render(article, terminalWidth()))))
+	return nil
+}
+
+// Turn automatic article extraction on or off for new posts in a feed
+func handlerFeedArticles(s *state, cmd command, user database.User) error {
+	if cmd.args[1] != "on" && cmd.args[1] != "off" {
+		return cmd.usageErrorf("expected on or off, got '%s'", cmd.args[1])
+	}
+
+	feed, err := managedFeed(s, user, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	err = s.db.SetFeedFetchArticles(context.Background(), database.SetFeedFetchArticlesParams{
+		FetchArticles: cmd.args[1] == "on",
+		UpdatedAt:     time.Now().UTC(),
+		ID:            feed.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("error updating feed: %v", err)
+	}
+
+	fmt.Printf("Article extraction turned %s for %s\n", cmd.args[1], htmltext.StripControl(feed.Name))
+	return nil
+}
+
+// Downloads the post's page, extracts and sanitizes its main article and
+// stores it with the post
+func fetchArticle(ctx context.Context, s *state, post database.Post) (string, error) {
+	err := s.limiter.wait(ctx, post.Url)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", post.Url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "gator")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	c := http.Client{Timeout: 10 * time.Second}
+	res, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %s", res.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return "", fmt.Errorf("%s is not a web page (%s)", post.Url, mediaType)
+	}
+
+	article, err := readability.Extract(io.LimitReader(res.Body, maxArticlePageSize), res.Request.URL)
+	if err != nil {
+		return "", err
+	}
+	article = htmltext.Sanitize(article)
+
+	err = s.db.SetPostArticle(ctx, database.SetPostArticleParams{
+		ArticleContent:   sql.NullString{String: article, Valid: true},
+		ArticleFetchedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:               post.ID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error saving article: %v", err)
+	}
+	return article, nil
+}
+
+// Works through the article queue in the background, so slow pages don't
+// hold up polling or WebSub pushes
+func startArticleWorker(s *state) {
+	go func() {
+		for {
+			processArticleQueue(s)
+			time.Sleep(articleQueueInterval)
+		}
+	}()
+}
+
+// Extracts articles for the oldest queued posts. Failures aren't retried:
+// they're mostly pages we can't extract anything from.
+func processArticleQueue(s *state) {
+	posts, err := s.db.GetQueuedArticles(context.Background(), articleQueueBatch)
+	if err != nil {
+		log.Println("error getting queued articles:", err)
+		return
+	}
+	for _, post := range posts {
+		_, err := fetchArticle(context.Background(), s, post)
+		if err != nil {
+			log.Printf("couldn't fetch article for %s: %v", post.Url, err)
+		}
+		err = s.db.DequeueArticle(context.Background(), post.ID)
+		if err != nil {
+			log.Println("error dequeuing article:", err)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tepidmilk/gator/internal/database"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+// Prefix of session tokens stored in the config
+const sessionTokenPrefix = "gatorsess_"
+
+// How long sessions last before the user has to log in again
+const (
+	cliSessionLifetime = 90 * 24 * time.Hour
+	webSessionLifetime = 7 * 24 * time.Hour
+)
+
+// Generates a random token for an API key or session
+func randomToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Tokens are long and random, so a plain SHA-256 is enough to keep them
+// from being usable if the database leaks
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the user logged in with the config's session token
+func currentUser(s *state) (database.User, error) {
+	if s.cfg.SessionToken == "" && s.cfg.LegacyUserName != "" {
+		return database.User{}, fmt.Errorf("gator now keeps you logged in with a session: run 'gator login %s' again", s.cfg.LegacyUserName)
+	}
+	if s.cfg.SessionToken == "" {
+		return database.User{}, errors.New("not logged in: run 'gator login <name>'")
+	}
+	user, err := s.db.GetSessionUser(context.Background(), database.GetSessionUserParams{
+		TokenHash: hashToken(s.cfg.SessionToken),
+		ExpiresAt: time.Now().UTC(),
+	})
+	if err == sql.ErrNoRows {
+		return database.User{}, errors.New("your session has ended: run 'gator login <name>'")
+	} else if err != nil {
+		return database.User{}, fmt.Errorf("error getting session: %v", err)
+	}
+	return user, nil
+}
+
+// Creates a session for the user and returns its token. Expired sessions
+// are cleaned up while we're at it.
+func createSession(ctx context.Context, s *state, user database.User, lifetime time.Duration) (string, error) {
+	token, err := randomToken(sessionTokenPrefix)
+	if err != nil {
+		return "", fmt.Errorf("error generating session token: %v", err)
+	}
+	now := time.Now().UTC()
+	err = s.db.CreateSession(ctx, database.CreateSessionParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(lifetime),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating session: %v", err)
+	}
+	_, err = s.db.DeleteExpiredSessions(ctx, now)
+	if err != nil {
+		log.Println("error deleting expired sessions:", err)
+	}
+	return token, nil
+}
+
+// Logs the user in, replacing the config's current session
+func startSession(s *state, user database.User) error {
+	token, err := createSession(context.Background(), s, user, cliSessionLifetime)
+	if err != nil {
+		return err
+	}
+	err = endSession(s)
+	if err != nil {
+		return err
+	}
+	err = s.cfg.SetSession(token)
+	if err != nil {
+		return fmt.Errorf("couldn't save session: %v", err)
+	}
+	return nil
+}
+
+// Ends the config's current session, if any
+func endSession(s *state) error {
+	if s.cfg.SessionToken == "" {
+		return nil
+	}
+	err := s.db.DeleteSession(context.Background(), hashToken(s.cfg.SessionToken))
+	if err != nil {
+		return fmt.Errorf("error ending session: %v", err)
+	}
+	return nil
+}
+
+// Checks a password against the user's hash. Users without a password
+// can log in without one.
+func checkPassword(user database.User) error {
+	if !user.PasswordHash.Valid {
+		return nil
+	}
+	password, err := readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash.String), []byte(password))
+	if err != nil {
+		return errors.New("wrong password")
+	}
+	return nil
+}
+
+// Asks for a new password twice and hashes it. Leaving it empty means the
+// user won't have a password.
+func promptNewPassword() (sql.NullString, error) {
+	password, err := readPassword("New password (leave empty for none): ")
+	if err != nil || password == "" {
+		return sql.NullString{}, err
+	}
+	confirm, err := readPassword("Confirm password: ")
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	if confirm != password {
+		return sql.NullString{}, errors.New("passwords don't match")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("error hashing password: %v", err)
+	}
+	return sql.NullString{String: string(hash), Valid: true}, nil
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// Reads a password without echoing it, or a line from stdin when it isn't
+// a terminal so scripts can pipe one in
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		password, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("error reading password: %v", err)
+		}
+		return string(password), nil
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("error reading password: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Set, change or remove the current user's password. Other sessions are
+// logged out.
+func handlerPasswd(s *state, cmd command, user database.User) error {
+	if user.PasswordHash.Valid {
+		fmt.Fprintln(os.Stderr, "Enter your current password.")
+		err := checkPassword(user)
+		if err != nil {
+			return err
+		}
+	}
+	hash, err := promptNewPassword()
+	if err != nil {
+		return err
+	}
+	err = s.db.SetUserPassword(context.Background(), database.SetUserPasswordParams{
+		PasswordHash: hash,
+		UpdatedAt:    time.Now().UTC(),
+		ID:           user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("error setting password: %v", err)
+	}
+
+	err = s.db.DeleteSessionsForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("error ending sessions: %v", err)
+	}
+	s.cfg.SessionToken = ""
+	err = startSession(s, user)
+	if err != nil {
+		return err
+	}
+	if hash.Valid {
+		fmt.Println("Password set")
+	} else {
+		fmt.Println("Password removed")
+	}
+	return nil
+}
+
+func handlerLogout(s *state, cmd command) error {
+	err := endSession(s)
+	if err != nil {
+		return err
+	}
+	err = s.cfg.SetSession("")
+	if err != nil {
+		return fmt.Errorf("couldn't clear session: %v", err)
+	}
+	fmt.Println("Logged out")
+	return nil
+}
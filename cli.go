@@ -0,0 +1,251 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// A command's interface: what it's for, the arguments and flags it takes
+// and the handler that runs it
+type commandSpec struct {
+	// positional arguments in order; "<name>" is required, "[name]" optional
+	// and a final "[name...]" takes any number of values
+	args        []string
+	description string
+	// declares the command's flags, if it has any
+	flags   func(f *flag.FlagSet)
+	handler func(*state, command) error
+	// hidden commands are left out of help and completion
+	hidden bool
+}
+
+type command struct {
+	name  string
+	args  []string
+	flags *flag.FlagSet
+}
+
+type commands struct {
+	cmd map[string]commandSpec
+}
+
+// An invalid command line; main exits with status 2 for these
+type usageError struct {
+	cmd string
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// Reports a problem with the command's arguments found by its handler
+func (cmd command) usageErrorf(format string, a ...any) error {
+	return &usageError{cmd: cmd.name, msg: fmt.Sprintf(format, a...)}
+}
+
+// The flag's value, or the zero value when the command was built without
+// it, as when one handler calls another
+func (cmd command) stringFlag(name string) string {
+	f := cmd.lookupFlag(name)
+	if f == nil {
+		return ""
+	}
+	return f.Value.String()
+}
+
+func (cmd command) boolFlag(name string) bool {
+	f := cmd.lookupFlag(name)
+	if f == nil {
+		return false
+	}
+	value, _ := f.Value.(flag.Getter).Get().(bool)
+	return value
+}
+
+func (cmd command) lookupFlag(name string) *flag.Flag {
+	if cmd.flags == nil {
+		return nil
+	}
+	return cmd.flags.Lookup(name)
+}
+
+func (c *commands) register(name string, spec commandSpec) {
+	c.cmd[name] = spec
+}
+
+// Flags every command accepts, before or after the command's name
+func globalFlags(f *flag.FlagSet) {
+	f.String("output", "", "print listings as json, csv or table")
+}
+
+// Parses the command line against the command's spec and runs its handler
+func (c *commands) run(s *state, rawArgs []string) error {
+	global := flag.NewFlagSet("gator", flag.ContinueOnError)
+	global.SetOutput(io.Discard)
+	globalFlags(global)
+	err := global.Parse(rawArgs)
+	if err == flag.ErrHelp {
+		c.printHelp(os.Stdout, "")
+		return nil
+	} else if err != nil {
+		return &usageError{msg: err.Error()}
+	}
+	if global.NArg() == 0 {
+		return &usageError{msg: "no command given"}
+	}
+
+	name := global.Arg(0)
+	spec, ok := c.cmd[name]
+	if !ok {
+		return &usageError{msg: fmt.Sprintf("unknown command '%s'", name)}
+	}
+
+	cmd, err := spec.parse(name, global.Args()[1:])
+	if err == flag.ErrHelp {
+		c.printHelp(os.Stdout, name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// global flags given after the command's name win
+	s.output = global.Lookup("output").Value.String()
+	cmd.flags.Visit(func(f *flag.Flag) {
+		if f.Name == "output" {
+			s.output = f.Value.String()
+		}
+	})
+	switch s.output {
+	case "", outputJSON, outputCSV, outputTable:
+	default:
+		return cmd.usageErrorf("output must be json, csv or table, not '%s'", s.output)
+	}
+
+	return spec.handler(s, cmd)
+}
+
+// Separates flags from positional arguments and checks both against the
+// spec. Flags may come before, after or between positional arguments.
+func (spec commandSpec) parse(name string, rawArgs []string) (command, error) {
+	f := flag.NewFlagSet(name, flag.ContinueOnError)
+	f.SetOutput(io.Discard)
+	globalFlags(f)
+	if spec.flags != nil {
+		spec.flags(f)
+	}
+
+	var args []string
+	for {
+		err := f.Parse(rawArgs)
+		if err == flag.ErrHelp {
+			return command{}, err
+		} else if err != nil {
+			return command{}, &usageError{cmd: name, msg: err.Error()}
+		}
+		rest := f.Args()
+		if len(rest) == 0 {
+			break
+		}
+		// everything after a "--" terminator is positional
+		if len(rest) < len(rawArgs) && rawArgs[len(rawArgs)-len(rest)-1] == "--" {
+			args = append(args, rest...)
+			break
+		}
+		args = append(args, rest[0])
+		rawArgs = rest[1:]
+	}
+
+	required := 0
+	for _, arg := range spec.args {
+		if strings.HasPrefix(arg, "<") {
+			required++
+		}
+	}
+	if len(args) < required {
+		return command{}, &usageError{cmd: name, msg: fmt.Sprintf("missing argument %s", spec.args[len(args)])}
+	}
+	variadic := len(spec.args) > 0 && strings.HasSuffix(spec.args[len(spec.args)-1], "...]")
+	if len(args) > len(spec.args) && !variadic {
+		return command{}, &usageError{cmd: name, msg: fmt.Sprintf("unexpected argument '%s'", args[len(spec.args)])}
+	}
+
+	return command{name: name, args: args, flags: f}, nil
+}
+
+// Describes how to invoke a command, e.g. "gator browse [flags] [limit]"
+func (c *commands) usageLine(name string) string {
+	spec := c.cmd[name]
+	parts := []string{"gator", name}
+	if spec.flags != nil {
+		parts = append(parts, "[flags]")
+	}
+	parts = append(parts, spec.args...)
+	return strings.Join(parts, " ")
+}
+
+// Prints a command's full help, or the list of commands when name is empty
+func (c *commands) printHelp(w io.Writer, name string) {
+	spec, ok := c.cmd[name]
+	if !ok {
+		fmt.Fprintln(w, "Usage: gator <command> [flags] [args]")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Commands:")
+		names := c.visibleNames()
+		width := 0
+		for _, name := range names {
+			width = max(width, len(name))
+		}
+		for _, name := range names {
+			fmt.Fprintf(w, "  %-*s  %s\n", width, name, c.cmd[name].description)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Global flags:")
+		global := flag.NewFlagSet("gator", flag.ContinueOnError)
+		globalFlags(global)
+		global.SetOutput(w)
+		global.PrintDefaults()
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Run 'gator help <command>' or 'gator <command> --help' for details.")
+		return
+	}
+
+	fmt.Fprintf(w, "Usage: %s\n\n%s\n", c.usageLine(name), spec.description)
+	if spec.flags != nil {
+		f := flag.NewFlagSet(name, flag.ContinueOnError)
+		spec.flags(f)
+		f.SetOutput(w)
+		fmt.Fprintln(w, "\nFlags:")
+		f.PrintDefaults()
+	}
+	global := flag.NewFlagSet("gator", flag.ContinueOnError)
+	globalFlags(global)
+	global.SetOutput(w)
+	fmt.Fprintln(w, "\nGlobal flags:")
+	global.PrintDefaults()
+}
+
+// Prints a short reminder of how to use a command after a usage error
+func (c *commands) printUsage(w io.Writer, name string) {
+	if _, ok := c.cmd[name]; !ok {
+		fmt.Fprintln(w, "Run 'gator help' for a list of commands.")
+		return
+	}
+	fmt.Fprintf(w, "usage: %s\nRun 'gator %s --help' for details.\n", c.usageLine(name), name)
+}
+
+// Show the list of commands, or help for a single command
+func (c *commands) handlerHelp(s *state, cmd command) error {
+	if len(cmd.args) > 0 {
+		if _, ok := c.cmd[cmd.args[0]]; !ok {
+			return cmd.usageErrorf("unknown command '%s'", cmd.args[0])
+		}
+		c.printHelp(os.Stdout, cmd.args[0])
+		return nil
+	}
+	c.printHelp(os.Stdout, "")
+	return nil
+}
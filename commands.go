@@ -5,82 +5,79 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/tepidmilk/gator/internal/config"
 	"github.com/tepidmilk/gator/internal/database"
+	"github.com/tepidmilk/gator/internal/htmltext"
 )
 
 type state struct {
-	db  *database.Queries
-	cfg *config.Config
+	db *database.Queries
+	// the connection behind db, for health checks
+	conn    *sql.DB
+	cfg     *config.Config
+	limiter *hostLimiter
+	// format listings are printed in, from --output
+	output string
 }
 
-type command struct {
-	name string
-	args []string
-}
-
-type commands struct {
-	cmd map[string]func(*state, command) error
-}
-
-func (c *commands) run(s *state, cmd command) error {
-	val, ok := c.cmd[cmd.name]
-	if !ok {
-		return errors.New("invalid command name")
-	}
-	err := val(s, cmd)
-	if err != nil {
-		return err
-	}
-	return err
-}
-
-func (c *commands) register(name string, f func(*state, command) error) {
-	c.cmd[name] = f
-}
-
-// Log in a user to the config file
+// Log in as a user, asking for their password if they have one
 func handlerLogin(s *state, cmd command) error {
-
-	if len(cmd.args) < 1 {
-		return fmt.Errorf("usage: %s <name>", cmd.name)
-	}
-
-	_, err := s.db.GetUser(context.Background(), cmd.args[0])
+	user, err := s.db.GetUser(context.Background(), cmd.args[0])
 	if err == sql.ErrNoRows {
 		return errors.New("unable to login. user does not exist")
 	} else if err != nil {
 		return err
 	}
+	err = checkPassword(user)
+	if err != nil {
+		return err
+	}
 
-	err = s.cfg.SetUser(cmd.args[0])
+	err = startSession(s, user)
 	if err != nil {
-		return fmt.Errorf("couldn't set current user: %W", err)
+		return err
 	}
 
 	fmt.Printf("User has been set to %s\n", cmd.args[0])
-	return err
+	return nil
 }
 
 func handlerRegister(s *state, cmd command) error {
-	fmt.Println(cmd.args[0])
-	if len(cmd.args) < 1 {
-		return fmt.Errorf("usage: %s <name>", cmd.name)
-	}
-
 	_, err := s.db.GetUser(context.Background(), cmd.args[0])
 	if err == nil {
 		return errors.New("user already exists in database")
 	} else if err != sql.ErrNoRows {
 		return err
 	}
+	password, err := promptNewPassword()
+	if err != nil {
+		return err
+	}
 
-	s.db.CreateUser(context.Background(), database.CreateUserParams{ID: uuid.New(), CreatedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC(), Name: cmd.args[0]})
-	s.cfg.SetUser(cmd.args[0])
+	user, err := s.db.CreateUser(context.Background(), database.CreateUserParams{ID: uuid.New(), CreatedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC(), Name: cmd.args[0]})
+	if err != nil {
+		return fmt.Errorf("error creating user: %v", err)
+	}
+	if password.Valid {
+		err = s.db.SetUserPassword(context.Background(), database.SetUserPasswordParams{
+			PasswordHash: password,
+			UpdatedAt:    time.Now().UTC(),
+			ID:           user.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("error setting password: %v", err)
+		}
+	}
+	err = startSession(s, user)
+	if err != nil {
+		return err
+	}
 
 	fmt.Println("User successfully registered in Database")
 	return nil
@@ -92,45 +89,76 @@ func handlerReset(s *state, cmd command) error {
 }
 
 func handlerUsers(s *state, cmd command) error {
-	users, err := s.db.GetUsers(context.Background())
+	users, err := s.db.ListUsers(context.Background())
 	if err != nil {
 		return err
 	}
+	// listing users doesn't need a login, so there may be no current user
+	current, _ := currentUser(s)
+	if s.output != "" {
+		records := make([]userRecord, 0, len(users))
+		for _, user := range users {
+			records = append(records, newUserRecord(user, current.Name))
+		}
+		return writeRecords(os.Stdout, s.output, records)
+	}
 	for _, user := range users {
-		if user == s.cfg.CurrentUserName {
-			fmt.Printf("%s (current)\n", user)
+		if user.ID == current.ID {
+			fmt.Printf("%s (current)\n", user.Name)
 		} else {
-			fmt.Println(user)
+			fmt.Println(user.Name)
 		}
 	}
 	return err
 }
 
-func handlerAgg(s *state, cmd command) error {
-	if len(cmd.args) < 1 {
-		return fmt.Errorf("usage: %s <time_between_requests>", cmd.name)
-	}
+// Longest the scheduler sleeps before checking for newly added feeds
+const maxSchedulerSleep = time.Minute
 
-	timeBetweenRequests, err := time.ParseDuration(cmd.args[0])
-	if err != nil {
-		return fmt.Errorf("error parsing duration string: %v", err)
+func handlerAgg(s *state, cmd command) error {
+	defaultInterval := time.Hour
+	if len(cmd.args) > 0 {
+		interval, err := time.ParseDuration(cmd.args[0])
+		if err != nil {
+			return cmd.usageErrorf("error parsing duration string: %v", err)
+		}
+		defaultInterval = interval
 	}
 
-	fmt.Println("Collecting feeds every", timeBetweenRequests)
+	fmt.Println("Collecting feeds, polling new feeds every", defaultInterval)
 
-	ticker := time.NewTicker(timeBetweenRequests)
-	for ; ; <-ticker.C {
-		scrapeFeeds(s)
+	if s.cfg.WebSubCallbackURL != "" {
+		startWebSub(s)
 	}
+	if s.cfg.MetricsListenAddr != "" {
+		startMetrics(s, s.cfg.MetricsListenAddr)
+	}
+	startArticleWorker(s)
 
-	return err
+	var lastPrune time.Time
+	for {
+		markScraperProgress()
+		for scrapeFeeds(s, defaultInterval) {
+			markScraperProgress()
+		}
+		if time.Since(lastPrune) >= pruneInterval {
+			autoPrune(s)
+			lastPrune = time.Now()
+		}
+		time.Sleep(timeUntilNextFetch(s))
+	}
 }
 
-func handlerAddFeed(s *state, cmd command, user database.User) error {
-	if len(cmd.args) < 2 {
-		return fmt.Errorf("usage: %s <Feed Name> <URL>", cmd.name)
+// How long the scheduler can sleep before the next feed is due
+func timeUntilNextFetch(s *state) time.Duration {
+	next, err := s.db.GetNextFetchTime(context.Background())
+	if err != nil || !next.Valid {
+		return maxSchedulerSleep
 	}
+	return min(max(time.Until(next.Time), time.Second), maxSchedulerSleep)
+}
 
+func handlerAddFeed(s *state, cmd command, user database.User) error {
 	name := cmd.args[0]
 	URL := cmd.args[1]
 	feed, err := s.db.CreateFeed(context.Background(), database.CreateFeedParams{
@@ -144,7 +172,7 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 	if err != nil {
 		return fmt.Errorf("error creating feed: %v", err)
 	}
-	fmt.Println("Feed Created:", feed.Name)
+	fmt.Println("Feed Created:", htmltext.StripControl(feed.Name))
 	err = handlerFollow(s, command{args: []string{URL}}, user)
 	if err != nil {
 		return err
@@ -158,34 +186,88 @@ func handlerFeeds(s *state, cmd command) error {
 	if err != nil {
 		return fmt.Errorf("error getting feeds: %v", err)
 	}
+	if s.output != "" {
+		records := make([]feedRecord, 0, len(feeds))
+		for _, feed := range feeds {
+			records = append(records, newFeedRecord(feed))
+		}
+		return writeRecords(os.Stdout, s.output, records)
+	}
 	for _, item := range feeds {
-		fmt.Printf(" - '%s' {%s} (user: %s)\n", item.Name, item.Url, item.Name_2)
+		fmt.Printf(" - [%s] '%s' {%s} (user: %s)\n", shortID(item.ID), htmltext.StripControl(item.Name), item.Url, item.UserName)
+		if item.SiteLink.Valid {
+			fmt.Printf("     Site: %s\n", item.SiteLink.String)
+		}
+		if item.Description.Valid {
+			fmt.Printf("     %s\n", htmltext.StripControl(item.Description.String))
+		}
+		if item.Language.Valid {
+			fmt.Printf("     Language: %s\n", item.Language.String)
+		}
 	}
 	return err
 }
 
-func handlerFollow(s *state, cmd command, user database.User) error {
-	if len(cmd.args) < 1 {
-		return fmt.Errorf("usage: %s <URL>", cmd.name)
+// Show everything we know about a single feed
+func handlerFeedInfo(s *state, cmd command) error {
+	feed, err := resolveFeed(s, cmd.args[0])
+	if err != nil {
+		return err
 	}
-	URL := cmd.args[0]
 
-	feedID, err := s.db.GetFeedByURL(context.Background(), URL)
+	fmt.Printf("Name:        %s\n", htmltext.StripControl(feed.Name))
+	fmt.Printf("URL:         %s\n", feed.Url)
+	fmt.Printf("Added by:    %s\n", feed.UserName)
+	fmt.Printf("Site:        %s\n", orNone(feed.SiteLink))
+	fmt.Printf("Description: %s\n", htmltext.StripControl(orNone(feed.Description)))
+	fmt.Printf("Language:    %s\n", orNone(feed.Language))
+	fmt.Printf("Image:       %s\n", orNone(feed.ImageUrl))
+	fmt.Printf("Generator:   %s\n", orNone(feed.Generator))
+	if feed.LastFethcedAt.Valid {
+		fmt.Printf("Last fetched: %s\n", feed.LastFethcedAt.Time.Format(time.RFC1123))
+	} else {
+		fmt.Println("Last fetched: never")
+	}
+	if feed.NextFetchAt.Valid {
+		fmt.Printf("Next fetch:   %s\n", feed.NextFetchAt.Time.Format(time.RFC1123))
+	}
+	if feed.PollIntervalSeconds.Valid {
+		fmt.Printf("Polled every: %s\n", time.Duration(feed.PollIntervalSeconds.Int32)*time.Second)
+	}
+	if feed.RetentionMaxAgeDays.Valid {
+		fmt.Printf("Keep posts:   %d days\n", feed.RetentionMaxAgeDays.Int32)
+	}
+	if feed.RetentionMaxPosts.Valid {
+		fmt.Printf("Keep at most: %d posts\n", feed.RetentionMaxPosts.Int32)
+	}
+	return nil
+}
+
+// returns the string value of a NullString or a placeholder when unset
+func orNone(s sql.NullString) string {
+	if !s.Valid {
+		return "(none)"
+	}
+	return s.String
+}
+
+func handlerFollow(s *state, cmd command, user database.User) error {
+	feed, err := resolveFeed(s, cmd.args[0])
 	if err != nil {
-		return errors.New("no feed exists at given URL: Try 'addfeed <name> <URL>")
+		return err
 	}
 	feedFollow, err := s.db.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
 		UserID:    user.ID,
-		FeedID:    feedID,
+		FeedID:    feed.ID,
 	})
 	if err != nil {
 		return fmt.Errorf("error creating feed follow record: %v", err)
 	}
 
-	fmt.Printf("%s is now following '%s'\n", feedFollow.UserName, feedFollow.FeedName)
+	fmt.Printf("%s is now following '%s'\n", feedFollow.UserName, htmltext.StripControl(feedFollow.FeedName))
 
 	return err
 }
@@ -195,26 +277,29 @@ func handlerFollowing(s *state, cmd command, user database.User) error {
 	if err != nil {
 		return fmt.Errorf("error getting followed feeds: %v", err)
 	}
+	if s.output != "" {
+		records := make([]followRecord, 0, len(feedsFollowing))
+		for _, item := range feedsFollowing {
+			records = append(records, newFollowRecord(item))
+		}
+		return writeRecords(os.Stdout, s.output, records)
+	}
 	for _, item := range feedsFollowing {
-		fmt.Println(item.FeedName)
+		fmt.Println(htmltext.StripControl(item.FeedName))
 	}
 	return err
 }
 
-// Unfollow a feed given a feed URL
+// Unfollow a feed given its name, URL or ID
 func handlerUnfollow(s *state, cmd command, user database.User) error {
-	if len(cmd.args) < 1 {
-		return fmt.Errorf("usage: %s <URL>", cmd.name)
-	}
-
-	feedID, err := s.db.GetFeedByURL(context.Background(), cmd.args[0])
+	feed, err := resolveFeed(s, cmd.args[0])
 	if err != nil {
-		return fmt.Errorf("error getting feed Id: %v", err)
+		return err
 	}
 
 	err = s.db.DeleteFeedFollows(context.Background(), database.DeleteFeedFollowsParams{
 		UserID: user.ID,
-		FeedID: feedID,
+		FeedID: feed.ID,
 	})
 	if err != nil {
 		return fmt.Errorf("error deleting feed follow: %v", err)
@@ -223,38 +308,151 @@ func handlerUnfollow(s *state, cmd command, user database.User) error {
 	return err
 }
 
+// Default number of posts browse shows per page
+const browsePageSize = 10
+
+// Browse the latest posts from followed feeds. Pass --full to show each
+// post's extracted article or full body instead of its summary, and
+// --author, --category, --feed, --since or --until to only show matching
+// posts. Each page ends with the --cursor that fetches the next one.
 func handlerBrowse(s *state, cmd command, user database.User) error {
-	var limit int32 = 2
-	if len(cmd.args) < 1 {
-		posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{
-			UserID: user.ID,
-			Limit:  limit,
-		})
+	params := database.BrowsePostsNewestParams{
+		UserID:   user.ID,
+		MaxPosts: browsePageSize,
+	}
+	if len(cmd.args) > 0 {
+		newLimit, err := strconv.Atoi(cmd.args[0])
+		if err != nil || newLimit < 1 {
+			return cmd.usageErrorf("limit must be a positive number: %s", cmd.args[0])
+		}
+		params.MaxPosts = int32(newLimit)
+	}
+	if author := cmd.stringFlag("author"); author != "" {
+		params.Author = sql.NullString{String: author, Valid: true}
+	}
+	if category := cmd.stringFlag("category"); category != "" {
+		params.Category = sql.NullString{String: category, Valid: true}
+	}
+	if ref := cmd.stringFlag("feed"); ref != "" {
+		feed, err := resolveFeed(s, ref)
 		if err != nil {
-			return fmt.Errorf("error getting posts for user: %v", err)
+			return err
 		}
-		for _, post := range posts {
-			fmt.Println(post.Title)
-			fmt.Println(post.Description)
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	now := time.Now().UTC()
+	if since := cmd.stringFlag("since"); since != "" {
+		t, err := parseTimeFilter(since, now)
+		if err != nil {
+			return cmd.usageErrorf("--since: %v", err)
 		}
-		return err
-	} else {
-		newLimit, err := strconv.Atoi(cmd.args[0])
+		params.Since = sql.NullTime{Time: t, Valid: true}
+	}
+	if until := cmd.stringFlag("until"); until != "" {
+		t, err := parseTimeFilter(until, now)
 		if err != nil {
-			return fmt.Errorf("usage: %s <optional limit int32>", cmd.name)
+			return cmd.usageErrorf("--until: %v", err)
 		}
-		posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{
-			UserID: user.ID,
-			Limit:  int32(newLimit),
-		})
-		fmt.Printf("Found %d posts for user %s\n", len(posts), user.Name)
+		params.Until = sql.NullTime{Time: t, Valid: true}
+	}
+	if cursor := cmd.stringFlag("cursor"); cursor != "" {
+		t, id, err := decodeCursor(cursor)
+		if err != nil {
+			return cmd.usageErrorf("%v", err)
+		}
+		params.CursorTime = sql.NullTime{Time: t, Valid: true}
+		params.CursorID = id
+	}
+	order := cmd.stringFlag("sort")
+	if order != sortNewest && order != sortOldest {
+		return cmd.usageErrorf("sort must be %s or %s, not '%s'", sortNewest, sortOldest, order)
+	}
+	full := cmd.boolFlag("full")
+
+	posts, err := browsePosts(s, params, order)
+	if err != nil {
+		return fmt.Errorf("error getting posts for user: %v", err)
+	}
+	if s.output != "" {
+		records := make([]postRecord, 0, len(posts))
 		for _, post := range posts {
-			fmt.Printf("%s from %s\n", post.PublishedAt.Time.Format("Mon Jan 2"), post.FeedName)
-			fmt.Printf("--- %s ---\n", post.Title)
-			fmt.Printf("    %v\n", post.Description.String)
-			fmt.Printf("Link: %s\n", post.Url)
-			fmt.Println("=======================================")
+			record, err := newPostRecord(s, post, full)
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
 		}
-		return err
+		return writeRecords(os.Stdout, s.output, records)
+	}
+	fmt.Printf("Found %d posts for user %s\n", len(posts), user.Name)
+	for _, post := range posts {
+		body := post.Description.String
+		if full && post.ArticleContent.Valid {
+			body = post.ArticleContent.String
+		} else if full && post.Content.Valid {
+			body = post.Content.String
+		}
+		marks := ""
+		if post.StarredAt.Valid {
+			marks += " *"
+		}
+		if !post.ReadAt.Valid {
+			marks += " (unread)"
+		}
+		fmt.Printf("%s from %s [%s]%s\n", post.PublishedAt.Time.Format("Mon Jan 2"), htmltext.StripControl(post.FeedName), shortID(post.ID), marks)
+		fmt.Printf("--- %s ---\n", htmltext.StripControl(post.Title))
+		authors, err := s.db.GetAuthorsForPost(context.Background(), post.ID)
+		if err != nil {
+			return fmt.Errorf("error getting authors: %v", err)
+		}
+		if len(authors) > 0 {
+			fmt.Printf("    By %s\n", htmltext.StripControl(strings.Join(authors, ", ")))
+		}
+		categories, err := s.db.GetCategoriesForPost(context.Background(), post.ID)
+		if err != nil {
+			return fmt.Errorf("error getting categories: %v", err)
+		}
+		if len(categories) > 0 {
+			fmt.Printf("    Categories: %s\n", htmltext.StripControl(strings.Join(categories, ", ")))
+		}
+		if post.ItunesEpisode.Valid {
+			fmt.Printf("    Episode %d\n", post.ItunesEpisode.Int32)
+		}
+		if post.ItunesDuration.Valid {
+			fmt.Printf("    Duration: %s\n", post.ItunesDuration.String)
+		}
+		if post.ItunesImage.Valid {
+			fmt.Printf("    Artwork: %s\n", post.ItunesImage.String)
+		}
+		fmt.Println(indent(htmltext.Render(body, terminalWidth()-4), "    "))
+		fmt.Printf("Link: %s\n", post.Url)
+		err = printEnclosures(s, post.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Println("=======================================")
+	}
+	if len(posts) == int(params.MaxPosts) {
+		fmt.Printf("More posts: add --cursor %s\n", encodeCursor(posts[len(posts)-1]))
 	}
+	return err
+}
+
+func printEnclosures(s *state, postID uuid.UUID) error {
+	enclosures, err := s.db.GetEnclosuresForPost(context.Background(), postID)
+	if err != nil {
+		return fmt.Errorf("error getting enclosures: %v", err)
+	}
+	for _, enclosure := range enclosures {
+		fmt.Printf("Enclosure: %s", enclosure.Url)
+		if enclosure.MimeType.Valid {
+			fmt.Printf(" (%s", enclosure.MimeType.String)
+			if enclosure.Length.Valid {
+				fmt.Printf(", %.1f MB", float64(enclosure.Length.Int64)/(1<<20))
+			}
+			fmt.Print(")")
+		}
+		fmt.Println()
+	}
+	return nil
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The shell scripts only know how to ask `gator __complete` for candidates,
+// so completion stays in sync with the registered commands
+const bashCompletion = `# bash completion for gator
+_gator() {
+    local cur words cword
+    if declare -F _get_comp_words_by_ref >/dev/null; then
+        _get_comp_words_by_ref -n : cur words cword
+    else
+        cur="${COMP_WORDS[COMP_CWORD]}"
+        words=("${COMP_WORDS[@]}")
+        cword=$COMP_CWORD
+    fi
+    local IFS=$'\n'
+    COMPREPLY=($(gator __complete -- "${words[@]:1:cword}" 2>/dev/null))
+    if declare -F __ltrim_colon_completions >/dev/null; then
+        __ltrim_colon_completions "$cur"
+    fi
+}
+complete -F _gator gator
+`
+
+const zshCompletion = `#compdef gator
+_gator() {
+    local -a candidates
+    candidates=(${(f)"$(gator __complete -- "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    compadd -a candidates
+}
+compdef _gator gator
+`
+
+const fishCompletion = `# fish completion for gator
+function __gator_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    gator __complete -- $tokens[2..-1] 2>/dev/null
+end
+complete -c gator -f -a '(__gator_complete)'
+`
+
+// Print a shell completion script
+func handlerCompletion(s *state, cmd command) error {
+	switch cmd.args[0] {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		return cmd.usageErrorf("unsupported shell '%s'", cmd.args[0])
+	}
+	return nil
+}
+
+// Print the candidates for the last of the given words, one per line
+func (c *commands) handlerComplete(s *state, cmd command) error {
+	for _, candidate := range c.complete(s, cmd.args) {
+		fmt.Println(candidate)
+	}
+	return nil
+}
+
+// Works out whether the last word is a command, flag, flag value or
+// positional argument and returns the values it could be
+func (c *commands) complete(s *state, words []string) []string {
+	if len(words) == 0 {
+		return nil
+	}
+	// skip global flags given before the command's name
+	for len(words) > 1 && strings.HasPrefix(words[0], "-") {
+		if words[0] == "--output" || words[0] == "-output" {
+			if len(words) == 2 {
+				return withPrefix(c.completionValues(s, "", "--output"), words[1])
+			}
+			words = words[1:]
+		}
+		words = words[1:]
+	}
+	current := words[len(words)-1]
+	if len(words) == 1 {
+		return withPrefix(c.visibleNames(), current)
+	}
+
+	name := words[0]
+	spec, ok := c.cmd[name]
+	if !ok || spec.hidden {
+		return nil
+	}
+	f := flag.NewFlagSet(name, flag.ContinueOnError)
+	globalFlags(f)
+	if spec.flags != nil {
+		spec.flags(f)
+	}
+
+	position := 0
+	pendingFlag := ""
+	terminated := false
+	for _, word := range words[1 : len(words)-1] {
+		switch {
+		case pendingFlag != "":
+			pendingFlag = ""
+		case terminated:
+			position++
+		case word == "--":
+			terminated = true
+		case strings.HasPrefix(word, "-") && len(word) > 1:
+			flagName, _, hasValue := strings.Cut(strings.TrimLeft(word, "-"), "=")
+			if fl := f.Lookup(flagName); fl != nil && !hasValue && !isBoolFlag(fl) {
+				pendingFlag = flagName
+			}
+		default:
+			position++
+		}
+	}
+
+	if pendingFlag != "" {
+		return withPrefix(c.completionValues(s, name, "--"+pendingFlag), current)
+	}
+	if !terminated && strings.HasPrefix(current, "-") {
+		var flags []string
+		f.VisitAll(func(fl *flag.Flag) {
+			flags = append(flags, "--"+fl.Name)
+		})
+		return withPrefix(flags, current)
+	}
+	if position >= len(spec.args) {
+		return nil
+	}
+	return withPrefix(c.completionValues(s, name, spec.args[position]), current)
+}
+
+// The values an argument or flag of a command can take, looked up from the
+// database where needed. Errors just mean there's nothing to offer.
+func (c *commands) completionValues(s *state, cmdName, arg string) []string {
+	switch arg {
+	case "[command]":
+		return c.visibleNames()
+	case "<name>":
+		users, _ := s.db.GetUsers(context.Background())
+		return users
+	case "<on|off>":
+		return []string{"on", "off"}
+	case "<bash|zsh|fish>":
+		return []string{"bash", "zsh", "fish"}
+	case "--output":
+		return []string{outputJSON, outputCSV, outputTable}
+	case "--sort":
+		return []string{sortNewest, sortOldest}
+	case "<feed>", "--feed":
+		// only feeds you follow can be unfollowed or browsed
+		if cmdName == "unfollow" || cmdName == "browse" {
+			user, _ := currentUser(s)
+			follows, _ := s.db.GetFeedFollowsForUser(context.Background(), user.Name)
+			urls := make([]string, 0, len(follows))
+			for _, follow := range follows {
+				urls = append(urls, follow.FeedUrl)
+			}
+			return urls
+		}
+		feeds, _ := s.db.GetFeeds(context.Background())
+		urls := make([]string, 0, len(feeds))
+		for _, feed := range feeds {
+			urls = append(urls, feed.Url)
+		}
+		return urls
+	}
+	return nil
+}
+
+func (c *commands) visibleNames() []string {
+	names := make([]string, 0, len(c.cmd))
+	for name, spec := range c.cmd {
+		if !spec.hidden {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isBoolFlag(fl *flag.Flag) bool {
+	value, ok := fl.Value.(interface{ IsBoolFlag() bool })
+	return ok && value.IsBoolFlag()
+}
+
+func withPrefix(values []string, prefix string) []string {
+	var matches []string
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) {
+			matches = append(matches, value)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tepidmilk/gator/internal/database"
+	"github.com/tepidmilk/gator/internal/htmltext"
+)
+
+// Directory under $HOME used when the config doesn't set download_dir
+const defaultDownloadDir = "gator-downloads"
+
+// Download a post's enclosures (podcast episodes and the like), resuming any
+// partial downloads left over from a previous attempt
+func handlerDownload(s *state, cmd command) error {
+	post, err := resolvePost(s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	enclosures, err := s.db.GetEnclosuresForPost(context.Background(), post.ID)
+	if err != nil {
+		return fmt.Errorf("error getting enclosures: %v", err)
+	}
+	if len(enclosures) == 0 {
+		return fmt.Errorf("'%s' has nothing to download", htmltext.StripControl(post.Title))
+	}
+
+	dir, err := downloadDir(s)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("error creating download directory: %v", err)
+	}
+
+	for _, enclosure := range enclosures {
+		dest := filepath.Join(dir, enclosureFileName(post, enclosure))
+		fmt.Printf("Downloading %s\n", enclosure.Url)
+		err := downloadFile(context.Background(), s.limiter, enclosure.Url, dest)
+		if err != nil {
+			return fmt.Errorf("error downloading %s: %v", enclosure.Url, err)
+		}
+		fmt.Printf("Saved to %s\n", dest)
+	}
+	return nil
+}
+
+func downloadDir(s *state) (string, error) {
+	if s.cfg.DownloadDir != "" {
+		return s.cfg.DownloadDir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, defaultDownloadDir), nil
+}
+
+// Names the file after the last element of the enclosure's URL path, falling
+// back to the post's ID when the URL doesn't end in a usable name
+func enclosureFileName(post database.Post, enclosure database.PostEnclosure) string {
+	name := ""
+	if u, err := url.Parse(enclosure.Url); err == nil {
+		name = path.Base(u.Path)
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" || name == ".." {
+		name = post.ID.String()
+	}
+	return shortID(enclosure.ID) + "-" + name
+}
+
+// A download fails if the server stops sending data for this long. There's
+// no overall timeout since large episodes can take a while.
+const downloadStallTimeout = 30 * time.Second
+
+var downloadClient = newDownloadClient()
+
+func newDownloadClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = downloadStallTimeout
+	return &http.Client{Transport: transport}
+}
+
+// Downloads rawURL to dest. Data is written to dest+".part" first so an
+// interrupted download can be resumed with a Range request. The response's
+// ETag or Last-Modified is kept alongside it and sent back as If-Range, so a
+// file that changed in between is downloaded again rather than stitched
+// onto the old one.
+func downloadFile(ctx context.Context, limiter *hostLimiter, rawURL, dest string) error {
+	if _, err := os.Stat(dest); err == nil {
+		fmt.Println("Already downloaded")
+		return nil
+	}
+
+	partial := dest + ".part"
+	validatorFile := partial + ".validator"
+	var offset int64
+	var validator string
+	if info, err := os.Stat(partial); err == nil {
+		data, err := os.ReadFile(validatorFile)
+		// without a validator we can't tell whether the file changed
+		if err == nil && len(data) > 0 {
+			offset = info.Size()
+			validator = string(data)
+		}
+	}
+
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	res, err := requestDownload(reqCtx, limiter, rawURL, offset, validator)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	total := int64(-1)
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		var start int64
+		start, total, err = parseContentRange(res.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			fmt.Println("The server sent the wrong part of the file, starting over")
+			return restartDownload(ctx, limiter, rawURL, dest, res)
+		}
+		fmt.Printf("Resuming from %d bytes\n", offset)
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// a fresh start: the server ignored our Range header or the file
+		// changed since the partial download
+		if offset > 0 {
+			fmt.Println("The file changed, starting over")
+		}
+		offset = 0
+		total = res.ContentLength
+		flags |= os.O_TRUNC
+		err = saveValidator(validatorFile, res.Header)
+		if err != nil {
+			return err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// we may already have every byte; only trust that if the server
+		// says the file is exactly as long as ours
+		_, total, err = parseContentRange(res.Header.Get("Content-Range"))
+		if offset == 0 {
+			return fmt.Errorf("unexpected status: %s", res.Status)
+		} else if err != nil || total != offset {
+			fmt.Println("The partial download doesn't match the file, starting over")
+			return restartDownload(ctx, limiter, rawURL, dest, res)
+		}
+		return finishDownload(partial, validatorFile, dest)
+	default:
+		return fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	f, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return err
+	}
+	stall := time.AfterFunc(downloadStallTimeout, cancel)
+	defer stall.Stop()
+	n, err := io.Copy(f, &stallReader{r: res.Body, timer: stall})
+	closeErr := f.Close()
+	if err != nil {
+		if reqCtx.Err() != nil && ctx.Err() == nil {
+			err = fmt.Errorf("no data for %s", downloadStallTimeout)
+		}
+		return fmt.Errorf("download interrupted after %d bytes, run the command again to resume: %v", offset+n, err)
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	if total >= 0 && offset+n != total {
+		return errors.New("download incomplete, run the command again to resume")
+	}
+
+	return finishDownload(partial, validatorFile, dest)
+}
+
+// Throws away a partial download we can't resume from and downloads the
+// whole file. Without a partial download no Range is sent, so this can't
+// loop.
+func restartDownload(ctx context.Context, limiter *hostLimiter, rawURL, dest string, res *http.Response) error {
+	res.Body.Close()
+	for _, path := range []string{dest + ".part", dest + ".part.validator"} {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return downloadFile(ctx, limiter, rawURL, dest)
+}
+
+func requestDownload(ctx context.Context, limiter *hostLimiter, rawURL string, offset int64, validator string) (*http.Response, error) {
+	err := limiter.wait(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "gator")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+	return downloadClient.Do(req)
+}
+
+// Remembers what identifies this version of the file. If-Range only
+// accepts strong ETags, so weak ones fall back to Last-Modified.
+func saveValidator(path string, header http.Header) error {
+	validator := header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = header.Get("Last-Modified")
+	}
+	if validator == "" {
+		// the download can't be resumed safely
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path, []byte(validator), 0644)
+}
+
+func finishDownload(partial, validatorFile, dest string) error {
+	err := os.Rename(partial, dest)
+	if err != nil {
+		return err
+	}
+	os.Remove(validatorFile)
+	return nil
+}
+
+// Parses "bytes start-end/total" or "bytes */total". The total is -1 when
+// the server doesn't know it.
+func parseContentRange(value string) (start, total int64, err error) {
+	spec, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, 0, fmt.Errorf("bad Content-Range %q", value)
+	}
+	rng, size, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("bad Content-Range %q", value)
+	}
+	total = -1
+	if size != "*" {
+		total, err = strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("bad Content-Range %q", value)
+		}
+	}
+	if rng == "*" {
+		return 0, total, nil
+	}
+	first, _, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("bad Content-Range %q", value)
+	}
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad Content-Range %q", value)
+	}
+	return start, total, nil
+}
+
+// Pushes back the stall timer whenever data arrives
+type stallReader struct {
+	r     io.Reader
+	timer *time.Timer
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 {
+		s.timer.Reset(downloadStallTimeout)
+	}
+	return n, err
+}
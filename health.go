@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// How long a health check may wait on the database
+const healthCheckTimeout = 2 * time.Second
+
+// agg isn't ready if its scrape loop hasn't come round in this long. The
+// loop never sleeps for more than maxSchedulerSleep, so this leaves plenty
+// of room for a slow batch of fetches.
+const scraperStallThreshold = 10 * time.Minute
+
+//go:embed sql/schema/*.sql
+var schemaFiles embed.FS
+
+// When agg's scrape loop last came round, in Unix nanoseconds
+var scraperProgress atomic.Int64
+
+func markScraperProgress() {
+	scraperProgress.Store(time.Now().UnixNano())
+}
+
+// Serves /healthz and /readyz. checkScraper is set in agg, where readiness
+// also depends on the scrape loop making progress.
+func registerHealth(mux *http.ServeMux, s *state, checkScraper bool) {
+	// alive if we can reach the database
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, map[string]error{
+			"database": pingDatabase(r.Context(), s),
+		})
+	})
+
+	// ready once the schema is current and, in agg, feeds are being polled
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		checks := map[string]error{
+			"database": pingDatabase(r.Context(), s),
+		}
+		if checks["database"] == nil {
+			checks["migrations"] = checkMigrations(r.Context(), s)
+		}
+		if checkScraper {
+			checks["scraper"] = checkScraperProgress()
+		}
+		writeHealth(w, checks)
+	})
+}
+
+// Answers 200 if every check passed, else 503, listing each check's result
+func writeHealth(w http.ResponseWriter, checks map[string]error) {
+	status := http.StatusOK
+	results := make(map[string]string, len(checks))
+	for name, err := range checks {
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			results[name] = err.Error()
+		} else {
+			results[name] = "ok"
+		}
+	}
+	text := "ok"
+	if status != http.StatusOK {
+		text = "unavailable"
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, map[string]any{
+		"status": text,
+		"checks": results,
+	})
+}
+
+func pingDatabase(ctx context.Context, s *state) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	err := s.conn.PingContext(ctx)
+	if err != nil {
+		return fmt.Errorf("can't reach database: %v", err)
+	}
+	return nil
+}
+
+// Compares goose's applied version with the newest migration gator was
+// built with
+func checkMigrations(ctx context.Context, s *state) error {
+	want, err := latestMigration()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	// goose's table isn't part of the sqlc schema, so query it directly
+	var have int64
+	err = s.conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied").Scan(&have)
+	if err != nil {
+		return fmt.Errorf("error getting schema version: %v", err)
+	}
+	if have < want {
+		return fmt.Errorf("schema is at version %d, want %d: run the migrations", have, want)
+	}
+	return nil
+}
+
+// The version of the newest file in sql/schema
+func latestMigration() (int64, error) {
+	names, err := fs.Glob(schemaFiles, "sql/schema/*.sql")
+	if err != nil {
+		return 0, err
+	}
+	var latest int64
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(strings.TrimPrefix(name, "sql/schema/"), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad migration name %q", name)
+		}
+		latest = max(latest, version)
+	}
+	return latest, nil
+}
+
+func checkScraperProgress() error {
+	last := scraperProgress.Load()
+	if last == 0 {
+		return errors.New("scrape loop hasn't started")
+	}
+	since := time.Since(time.Unix(0, last))
+	if since > scraperStallThreshold {
+		return fmt.Errorf("scrape loop hasn't made progress in %s", since.Round(time.Second))
+	}
+	return nil
+}
@@ -10,8 +10,34 @@ const (
 )
 
 type Config struct {
-	DbURL           string `json:"db_url"`
-	CurrentUserName string `json:"current_user_name"`
+	DbURL string `json:"db_url"`
+	// Token for the logged in user's session; the database only knows
+	// its hash
+	SessionToken string `json:"session_token,omitempty"`
+	// The logged in user from before sessions, kept only to tell them to
+	// log in again; cleared once they do
+	LegacyUserName string `json:"current_user_name,omitempty"`
+	// Per-host politeness for feed fetches; zero values use the defaults
+	HostRequestsPerMinute float64 `json:"host_requests_per_minute,omitempty"`
+	HostBurst             int     `json:"host_burst,omitempty"`
+	// Public base URL hubs push WebSub content to, and the address agg
+	// listens on for it. WebSub is disabled when the callback URL is empty.
+	WebSubCallbackURL string `json:"websub_callback_url,omitempty"`
+	WebSubListenAddr  string `json:"websub_listen_addr,omitempty"`
+	// Address agg serves Prometheus metrics and health checks on; disabled
+	// when empty
+	MetricsListenAddr string `json:"metrics_listen_addr,omitempty"`
+	// Base URL `serve` can be reached at, for links it hands out such as
+	// feedurl's; defaults to http://localhost:8081
+	PublicURL string `json:"public_url,omitempty"`
+	// Where `download` saves enclosures; defaults to ~/gator-downloads
+	DownloadDir string `json:"download_dir,omitempty"`
+	// Default retention for feeds without their own policy; zero keeps posts
+	// forever. Starred posts are always kept, and so are posts a follower
+	// hasn't read unless retention_prune_unread is set.
+	RetentionMaxAgeDays  int  `json:"retention_max_age_days,omitempty"`
+	RetentionMaxPosts    int  `json:"retention_max_posts,omitempty"`
+	RetentionPruneUnread bool `json:"retention_prune_unread,omitempty"`
 }
 
 func Read() (Config, error) {
@@ -42,8 +68,9 @@ func getConfigFilePath() (string, error) {
 	return filePath, nil
 }
 
-func (c *Config) SetUser(user string) error {
-	c.CurrentUserName = user
+func (c *Config) SetSession(token string) error {
+	c.SessionToken = token
+	c.LegacyUserName = ""
 	return write(*c)
 }
 
@@ -56,9 +83,10 @@ func write(cfg Config) error {
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(filePath, data, 0666)
+	// the session token is a secret, so keep the file private
+	err = os.WriteFile(filePath, data, 0600)
 	if err != nil {
 		return err
 	}
-	return err
+	return os.Chmod(filePath, 0600)
 }
@@ -88,7 +88,7 @@ func (q *Queries) DeleteFeedFollows(ctx context.Context, arg DeleteFeedFollowsPa
 }
 
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
-SELECT users.name as user_name, feeds.name as feed_name, feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_id FROM feed_follows
+SELECT users.name as user_name, feeds.name as feed_name, feeds.url as feed_url, feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_id FROM feed_follows
 INNER JOIN users on users.id = feed_follows.user_id
 INNER JOIN feeds on feeds.id = feed_follows.feed_id
 WHERE users.name = $1
@@ -97,6 +97,7 @@ WHERE users.name = $1
 type GetFeedFollowsForUserRow struct {
 	UserName  string
 	FeedName  string
+	FeedUrl   string
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -116,6 +117,7 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, name string) ([]Get
 		if err := rows.Scan(
 			&i.UserName,
 			&i.FeedName,
+			&i.FeedUrl,
 			&i.ID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
@@ -23,7 +23,7 @@ VALUES (
     $5,
     $6
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fethced_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fethced_at, site_link, description, language, image_url, generator, next_fetch_at, poll_interval_seconds, fetch_articles, retention_max_age_days, retention_max_posts
 `
 
 type CreateFeedParams struct {
@@ -53,6 +53,138 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFethcedAt,
+		&i.SiteLink,
+		&i.Description,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.NextFetchAt,
+		&i.PollIntervalSeconds,
+		&i.FetchArticles,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
+	)
+	return i, err
+}
+
+const deleteFeed = `-- name: DeleteFeed :exec
+DELETE FROM feeds
+WHERE id = $1
+`
+
+func (q *Queries) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteFeed, id)
+	return err
+}
+
+const findFeeds = `-- name: FindFeeds :many
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fethced_at, feeds.site_link, feeds.description, feeds.language, feeds.image_url, feeds.generator, feeds.next_fetch_at, feeds.poll_interval_seconds, feeds.fetch_articles, feeds.retention_max_age_days, feeds.retention_max_posts, users.name as user_name
+FROM feeds INNER JOIN users
+ON feeds.user_id = users.id
+WHERE feeds.url LIKE $1::text
+OR lower(feeds.name) = lower($2::text)
+OR feeds.id::text LIKE $1::text
+-- exact matches first so they're never cut by the limit
+ORDER BY feeds.url = $2::text DESC,
+lower(feeds.name) = lower($2::text) DESC,
+feeds.name
+LIMIT 10
+`
+
+type FindFeedsParams struct {
+	Prefix string
+	Ref    string
+}
+
+type FindFeedsRow struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastFethcedAt       sql.NullTime
+	SiteLink            sql.NullString
+	Description         sql.NullString
+	Language            sql.NullString
+	ImageUrl            sql.NullString
+	Generator           sql.NullString
+	NextFetchAt         sql.NullTime
+	PollIntervalSeconds sql.NullInt32
+	FetchArticles       bool
+	RetentionMaxAgeDays sql.NullInt32
+	RetentionMaxPosts   sql.NullInt32
+	UserName            string
+}
+
+func (q *Queries) FindFeeds(ctx context.Context, arg FindFeedsParams) ([]FindFeedsRow, error) {
+	rows, err := q.db.QueryContext(ctx, findFeeds, arg.Prefix, arg.Ref)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FindFeedsRow
+	for rows.Next() {
+		var i FindFeedsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFethcedAt,
+			&i.SiteLink,
+			&i.Description,
+			&i.Language,
+			&i.ImageUrl,
+			&i.Generator,
+			&i.NextFetchAt,
+			&i.PollIntervalSeconds,
+			&i.FetchArticles,
+			&i.RetentionMaxAgeDays,
+			&i.RetentionMaxPosts,
+			&i.UserName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFeed = `-- name: GetFeed :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fethced_at, site_link, description, language, image_url, generator, next_fetch_at, poll_interval_seconds, fetch_articles, retention_max_age_days, retention_max_posts FROM feeds
+WHERE id = $1
+`
+
+func (q *Queries) GetFeed(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeed, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFethcedAt,
+		&i.SiteLink,
+		&i.Description,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.NextFetchAt,
+		&i.PollIntervalSeconds,
+		&i.FetchArticles,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
 	)
 	return i, err
 }
@@ -69,16 +201,86 @@ func (q *Queries) GetFeedByURL(ctx context.Context, url string) (uuid.UUID, erro
 	return id, err
 }
 
+const getFeedWithOwner = `-- name: GetFeedWithOwner :one
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fethced_at, feeds.site_link, feeds.description, feeds.language, feeds.image_url, feeds.generator, feeds.next_fetch_at, feeds.poll_interval_seconds, feeds.fetch_articles, feeds.retention_max_age_days, feeds.retention_max_posts, users.name as user_name
+FROM feeds INNER JOIN users
+ON feeds.user_id = users.id
+WHERE feeds.id = $1
+`
+
+type GetFeedWithOwnerRow struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastFethcedAt       sql.NullTime
+	SiteLink            sql.NullString
+	Description         sql.NullString
+	Language            sql.NullString
+	ImageUrl            sql.NullString
+	Generator           sql.NullString
+	NextFetchAt         sql.NullTime
+	PollIntervalSeconds sql.NullInt32
+	FetchArticles       bool
+	RetentionMaxAgeDays sql.NullInt32
+	RetentionMaxPosts   sql.NullInt32
+	UserName            string
+}
+
+func (q *Queries) GetFeedWithOwner(ctx context.Context, id uuid.UUID) (GetFeedWithOwnerRow, error) {
+	row := q.db.QueryRowContext(ctx, getFeedWithOwner, id)
+	var i GetFeedWithOwnerRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFethcedAt,
+		&i.SiteLink,
+		&i.Description,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.NextFetchAt,
+		&i.PollIntervalSeconds,
+		&i.FetchArticles,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
+		&i.UserName,
+	)
+	return i, err
+}
+
 const getFeeds = `-- name: GetFeeds :many
-SELECT feeds.name, feeds.url, users.name
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fethced_at, feeds.site_link, feeds.description, feeds.language, feeds.image_url, feeds.generator, feeds.next_fetch_at, feeds.poll_interval_seconds, feeds.fetch_articles, feeds.retention_max_age_days, feeds.retention_max_posts, users.name as user_name
 FROM feeds INNER JOIN users
 ON feeds.user_id = users.id
+ORDER BY feeds.name
 `
 
 type GetFeedsRow struct {
-	Name   string
-	Url    string
-	Name_2 string
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastFethcedAt       sql.NullTime
+	SiteLink            sql.NullString
+	Description         sql.NullString
+	Language            sql.NullString
+	ImageUrl            sql.NullString
+	Generator           sql.NullString
+	NextFetchAt         sql.NullTime
+	PollIntervalSeconds sql.NullInt32
+	FetchArticles       bool
+	RetentionMaxAgeDays sql.NullInt32
+	RetentionMaxPosts   sql.NullInt32
+	UserName            string
 }
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]GetFeedsRow, error) {
@@ -90,7 +292,26 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]GetFeedsRow, error) {
 	var items []GetFeedsRow
 	for rows.Next() {
 		var i GetFeedsRow
-		if err := rows.Scan(&i.Name, &i.Url, &i.Name_2); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFethcedAt,
+			&i.SiteLink,
+			&i.Description,
+			&i.Language,
+			&i.ImageUrl,
+			&i.Generator,
+			&i.NextFetchAt,
+			&i.PollIntervalSeconds,
+			&i.FetchArticles,
+			&i.RetentionMaxAgeDays,
+			&i.RetentionMaxPosts,
+			&i.UserName,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -105,12 +326,14 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]GetFeedsRow, error) {
 }
 
 const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fethced_at FROM feeds
-ORDER BY last_fethced_at ASC NULLS FIRST
+SELECT id, created_at, updated_at, name, url, user_id, last_fethced_at, site_link, description, language, image_url, generator, next_fetch_at, poll_interval_seconds, fetch_articles, retention_max_age_days, retention_max_posts FROM feeds
+WHERE next_fetch_at IS NULL OR next_fetch_at <= $1
+ORDER BY next_fetch_at ASC NULLS FIRST, last_fethced_at ASC NULLS FIRST
+LIMIT 1
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
+func (q *Queries) GetNextFeedToFetch(ctx context.Context, nextFetchAt sql.NullTime) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getNextFeedToFetch, nextFetchAt)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -120,22 +343,202 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFethcedAt,
+		&i.SiteLink,
+		&i.Description,
+		&i.Language,
+		&i.ImageUrl,
+		&i.Generator,
+		&i.NextFetchAt,
+		&i.PollIntervalSeconds,
+		&i.FetchArticles,
+		&i.RetentionMaxAgeDays,
+		&i.RetentionMaxPosts,
 	)
 	return i, err
 }
 
+const getNextFetchTime = `-- name: GetNextFetchTime :one
+SELECT next_fetch_at FROM feeds
+WHERE next_fetch_at IS NOT NULL
+ORDER BY next_fetch_at ASC
+LIMIT 1
+`
+
+func (q *Queries) GetNextFetchTime(ctx context.Context) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, getNextFetchTime)
+	var next_fetch_at sql.NullTime
+	err := row.Scan(&next_fetch_at)
+	return next_fetch_at, err
+}
+
+const getOldestDueTime = `-- name: GetOldestDueTime :one
+-- feeds that were never fetched have been due since they were added
+SELECT COALESCE(next_fetch_at, created_at)::timestamp AS due_at FROM feeds
+WHERE next_fetch_at IS NULL OR next_fetch_at <= $1
+ORDER BY due_at ASC
+LIMIT 1
+`
+
+func (q *Queries) GetOldestDueTime(ctx context.Context, nextFetchAt sql.NullTime) (time.Time, error) {
+	row := q.db.QueryRowContext(ctx, getOldestDueTime, nextFetchAt)
+	var due_at time.Time
+	err := row.Scan(&due_at)
+	return due_at, err
+}
+
 const markFeedFetched = `-- name: MarkFeedFetched :exec
 UPDATE feeds
-SET last_fethced_at = $1, updated_at = $1
-WHERE id = $2
+SET last_fethced_at = $1, updated_at = $1, next_fetch_at = $2
+WHERE id = $3
 `
 
 type MarkFeedFetchedParams struct {
 	LastFethcedAt sql.NullTime
+	NextFetchAt   sql.NullTime
 	ID            uuid.UUID
 }
 
 func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) error {
-	_, err := q.db.ExecContext(ctx, markFeedFetched, arg.LastFethcedAt, arg.ID)
+	_, err := q.db.ExecContext(ctx, markFeedFetched, arg.LastFethcedAt, arg.NextFetchAt, arg.ID)
+	return err
+}
+
+const renameFeed = `-- name: RenameFeed :exec
+UPDATE feeds
+SET name = $1, updated_at = $2
+WHERE id = $3
+`
+
+type RenameFeedParams struct {
+	Name      string
+	UpdatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (q *Queries) RenameFeed(ctx context.Context, arg RenameFeedParams) error {
+	_, err := q.db.ExecContext(ctx, renameFeed, arg.Name, arg.UpdatedAt, arg.ID)
+	return err
+}
+
+const setFeedFetchArticles = `-- name: SetFeedFetchArticles :exec
+UPDATE feeds
+SET fetch_articles = $1, updated_at = $2
+WHERE id = $3
+`
+
+type SetFeedFetchArticlesParams struct {
+	FetchArticles bool
+	UpdatedAt     time.Time
+	ID            uuid.UUID
+}
+
+func (q *Queries) SetFeedFetchArticles(ctx context.Context, arg SetFeedFetchArticlesParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedFetchArticles, arg.FetchArticles, arg.UpdatedAt, arg.ID)
+	return err
+}
+
+const setFeedNextFetch = `-- name: SetFeedNextFetch :exec
+UPDATE feeds
+SET next_fetch_at = $1
+WHERE id = $2
+`
+
+type SetFeedNextFetchParams struct {
+	NextFetchAt sql.NullTime
+	ID          uuid.UUID
+}
+
+func (q *Queries) SetFeedNextFetch(ctx context.Context, arg SetFeedNextFetchParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedNextFetch, arg.NextFetchAt, arg.ID)
+	return err
+}
+
+const setFeedPollInterval = `-- name: SetFeedPollInterval :exec
+UPDATE feeds
+SET poll_interval_seconds = $1
+WHERE id = $2
+`
+
+type SetFeedPollIntervalParams struct {
+	PollIntervalSeconds sql.NullInt32
+	ID                  uuid.UUID
+}
+
+func (q *Queries) SetFeedPollInterval(ctx context.Context, arg SetFeedPollIntervalParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedPollInterval, arg.PollIntervalSeconds, arg.ID)
+	return err
+}
+
+const setFeedRetention = `-- name: SetFeedRetention :exec
+UPDATE feeds
+SET retention_max_age_days = $1, retention_max_posts = $2, updated_at = $3
+WHERE id = $4
+`
+
+type SetFeedRetentionParams struct {
+	RetentionMaxAgeDays sql.NullInt32
+	RetentionMaxPosts   sql.NullInt32
+	UpdatedAt           time.Time
+	ID                  uuid.UUID
+}
+
+func (q *Queries) SetFeedRetention(ctx context.Context, arg SetFeedRetentionParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedRetention,
+		arg.RetentionMaxAgeDays,
+		arg.RetentionMaxPosts,
+		arg.UpdatedAt,
+		arg.ID,
+	)
+	return err
+}
+
+const setFeedURL = `-- name: SetFeedURL :exec
+UPDATE feeds
+SET url = $1, updated_at = $2, next_fetch_at = NULL
+WHERE id = $3
+`
+
+type SetFeedURLParams struct {
+	Url       string
+	UpdatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (q *Queries) SetFeedURL(ctx context.Context, arg SetFeedURLParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedURL, arg.Url, arg.UpdatedAt, arg.ID)
+	return err
+}
+
+const updateFeedMetadata = `-- name: UpdateFeedMetadata :exec
+UPDATE feeds
+SET site_link = $1,
+description = $2,
+language = $3,
+image_url = $4,
+generator = $5,
+updated_at = $6
+WHERE id = $7
+`
+
+type UpdateFeedMetadataParams struct {
+	SiteLink    sql.NullString
+	Description sql.NullString
+	Language    sql.NullString
+	ImageUrl    sql.NullString
+	Generator   sql.NullString
+	UpdatedAt   time.Time
+	ID          uuid.UUID
+}
+
+func (q *Queries) UpdateFeedMetadata(ctx context.Context, arg UpdateFeedMetadataParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedMetadata,
+		arg.SiteLink,
+		arg.Description,
+		arg.Language,
+		arg.ImageUrl,
+		arg.Generator,
+		arg.UpdatedAt,
+		arg.ID,
+	)
 	return err
 }
@@ -11,14 +11,53 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	KeyHash    string
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type ArticleQueue struct {
+	PostID   uuid.UUID
+	QueuedAt time.Time
+}
+
+type Author struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string
+}
+
+type Category struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFethcedAt sql.NullTime
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastFethcedAt       sql.NullTime
+	SiteLink            sql.NullString
+	Description         sql.NullString
+	Language            sql.NullString
+	ImageUrl            sql.NullString
+	Generator           sql.NullString
+	NextFetchAt         sql.NullTime
+	PollIntervalSeconds sql.NullInt32
+	FetchArticles       bool
+	RetentionMaxAgeDays sql.NullInt32
+	RetentionMaxPosts   sql.NullInt32
 }
 
 type FeedFollow struct {
@@ -30,19 +69,76 @@ type FeedFollow struct {
 }
 
 type Post struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Title            string
+	Url              string
+	Description      sql.NullString
+	PublishedAt      sql.NullTime
+	FeedID           uuid.UUID
+	Content          sql.NullString
+	ItunesDuration   sql.NullString
+	ItunesEpisode    sql.NullInt32
+	ItunesImage      sql.NullString
+	ArticleContent   sql.NullString
+	ArticleFetchedAt sql.NullTime
 }
 
-type User struct {
+type PostAuthor struct {
+	PostID   uuid.UUID
+	AuthorID uuid.UUID
+}
+
+type PostCategory struct {
+	PostID     uuid.UUID
+	CategoryID uuid.UUID
+}
+
+type PostEnclosure struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Name      string
+	PostID    uuid.UUID
+	Url       string
+	MimeType  sql.NullString
+	Length    sql.NullInt64
+}
+
+type PostStatus struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	ReadAt    sql.NullTime
+	StarredAt sql.NullTime
+}
+
+type Session struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+type User struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Name          string
+	IsAdmin       bool
+	PasswordHash  sql.NullString
+	FeedTokenHash sql.NullString
+}
+
+type WebsubSubscription struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	FeedID         uuid.UUID
+	HubUrl         string
+	TopicUrl       string
+	Secret         string
+	State          string
+	RequestedAt    sql.NullTime
+	LeaseExpiresAt sql.NullTime
 }
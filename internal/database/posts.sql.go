@@ -13,8 +13,230 @@ import (
 	"github.com/google/uuid"
 )
 
+const browsePostsNewest = `-- name: BrowsePostsNewest :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.itunes_duration, posts.itunes_episode, posts.itunes_image, posts.article_content, posts.article_fetched_at, feeds.name as feed_name, post_statuses.read_at, post_statuses.starred_at FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN post_statuses ON post_statuses.post_id = posts.id
+AND post_statuses.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND ($2::text IS NULL OR EXISTS (
+    SELECT 1 FROM post_authors
+    INNER JOIN authors ON authors.id = post_authors.author_id
+    WHERE post_authors.post_id = posts.id
+    AND lower(authors.name) = lower($2::text)
+))
+AND ($3::text IS NULL OR EXISTS (
+    SELECT 1 FROM post_categories
+    INNER JOIN categories ON categories.id = post_categories.category_id
+    WHERE post_categories.post_id = posts.id
+    AND lower(categories.name) = lower($3::text)
+))
+AND ($4::uuid IS NULL OR posts.feed_id = $4::uuid)
+AND ($5::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) >= $5::timestamp)
+AND ($6::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) < $6::timestamp)
+AND ($7::timestamp IS NULL
+    OR (COALESCE(posts.published_at, posts.created_at), posts.id) < ($7::timestamp, $8::uuid))
+ORDER BY COALESCE(posts.published_at, posts.created_at) DESC, posts.id DESC
+LIMIT $9
+`
+
+type BrowsePostsNewestParams struct {
+	UserID     uuid.UUID
+	Author     sql.NullString
+	Category   sql.NullString
+	FeedID     uuid.NullUUID
+	Since      sql.NullTime
+	Until      sql.NullTime
+	CursorTime sql.NullTime
+	CursorID   uuid.UUID
+	MaxPosts   int32
+}
+
+type BrowsePostsNewestRow struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Title            string
+	Url              string
+	Description      sql.NullString
+	PublishedAt      sql.NullTime
+	FeedID           uuid.UUID
+	Content          sql.NullString
+	ItunesDuration   sql.NullString
+	ItunesEpisode    sql.NullInt32
+	ItunesImage      sql.NullString
+	ArticleContent   sql.NullString
+	ArticleFetchedAt sql.NullTime
+	FeedName         string
+	ReadAt           sql.NullTime
+	StarredAt        sql.NullTime
+}
+
+func (q *Queries) BrowsePostsNewest(ctx context.Context, arg BrowsePostsNewestParams) ([]BrowsePostsNewestRow, error) {
+	rows, err := q.db.QueryContext(ctx, browsePostsNewest,
+		arg.UserID,
+		arg.Author,
+		arg.Category,
+		arg.FeedID,
+		arg.Since,
+		arg.Until,
+		arg.CursorTime,
+		arg.CursorID,
+		arg.MaxPosts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BrowsePostsNewestRow
+	for rows.Next() {
+		var i BrowsePostsNewestRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Content,
+			&i.ItunesDuration,
+			&i.ItunesEpisode,
+			&i.ItunesImage,
+			&i.ArticleContent,
+			&i.ArticleFetchedAt,
+			&i.FeedName,
+			&i.ReadAt,
+			&i.StarredAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const browsePostsOldest = `-- name: BrowsePostsOldest :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.itunes_duration, posts.itunes_episode, posts.itunes_image, posts.article_content, posts.article_fetched_at, feeds.name as feed_name, post_statuses.read_at, post_statuses.starred_at FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN post_statuses ON post_statuses.post_id = posts.id
+AND post_statuses.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND ($2::text IS NULL OR EXISTS (
+    SELECT 1 FROM post_authors
+    INNER JOIN authors ON authors.id = post_authors.author_id
+    WHERE post_authors.post_id = posts.id
+    AND lower(authors.name) = lower($2::text)
+))
+AND ($3::text IS NULL OR EXISTS (
+    SELECT 1 FROM post_categories
+    INNER JOIN categories ON categories.id = post_categories.category_id
+    WHERE post_categories.post_id = posts.id
+    AND lower(categories.name) = lower($3::text)
+))
+AND ($4::uuid IS NULL OR posts.feed_id = $4::uuid)
+AND ($5::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) >= $5::timestamp)
+AND ($6::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) < $6::timestamp)
+AND ($7::timestamp IS NULL
+    OR (COALESCE(posts.published_at, posts.created_at), posts.id) > ($7::timestamp, $8::uuid))
+ORDER BY COALESCE(posts.published_at, posts.created_at) ASC, posts.id ASC
+LIMIT $9
+`
+
+type BrowsePostsOldestParams struct {
+	UserID     uuid.UUID
+	Author     sql.NullString
+	Category   sql.NullString
+	FeedID     uuid.NullUUID
+	Since      sql.NullTime
+	Until      sql.NullTime
+	CursorTime sql.NullTime
+	CursorID   uuid.UUID
+	MaxPosts   int32
+}
+
+type BrowsePostsOldestRow struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Title            string
+	Url              string
+	Description      sql.NullString
+	PublishedAt      sql.NullTime
+	FeedID           uuid.UUID
+	Content          sql.NullString
+	ItunesDuration   sql.NullString
+	ItunesEpisode    sql.NullInt32
+	ItunesImage      sql.NullString
+	ArticleContent   sql.NullString
+	ArticleFetchedAt sql.NullTime
+	FeedName         string
+	ReadAt           sql.NullTime
+	StarredAt        sql.NullTime
+}
+
+func (q *Queries) BrowsePostsOldest(ctx context.Context, arg BrowsePostsOldestParams) ([]BrowsePostsOldestRow, error) {
+	rows, err := q.db.QueryContext(ctx, browsePostsOldest,
+		arg.UserID,
+		arg.Author,
+		arg.Category,
+		arg.FeedID,
+		arg.Since,
+		arg.Until,
+		arg.CursorTime,
+		arg.CursorID,
+		arg.MaxPosts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BrowsePostsOldestRow
+	for rows.Next() {
+		var i BrowsePostsOldestRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Content,
+			&i.ItunesDuration,
+			&i.ItunesEpisode,
+			&i.ItunesImage,
+			&i.ArticleContent,
+			&i.ArticleFetchedAt,
+			&i.FeedName,
+			&i.ReadAt,
+			&i.StarredAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createPost = `-- name: CreatePost :exec
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, content, itunes_duration, itunes_episode, itunes_image)
 VALUES (
     $1,
     $2,
@@ -23,20 +245,28 @@ VALUES (
     $5,
     $6,
     $7,
-    $8
+    $8,
+    $9,
+    $10,
+    $11,
+    $12
 )
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, content, itunes_duration, itunes_episode, itunes_image, article_content, article_fetched_at
 `
 
 type CreatePostParams struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Title          string
+	Url            string
+	Description    sql.NullString
+	PublishedAt    sql.NullTime
+	FeedID         uuid.UUID
+	Content        sql.NullString
+	ItunesDuration sql.NullString
+	ItunesEpisode  sql.NullInt32
+	ItunesImage    sql.NullString
 }
 
 func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) error {
@@ -49,45 +279,36 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) error {
 		arg.Description,
 		arg.PublishedAt,
 		arg.FeedID,
+		arg.Content,
+		arg.ItunesDuration,
+		arg.ItunesEpisode,
+		arg.ItunesImage,
 	)
 	return err
 }
 
-const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, feeds.name as feed_name FROM posts
-INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
-INNER JOIN feeds ON posts.feed_id = feeds.id
-WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2
+const findPosts = `-- name: FindPosts :many
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, content, itunes_duration, itunes_episode, itunes_image, article_content, article_fetched_at FROM posts
+WHERE id::text LIKE $1::text
+OR url = $2::text
+ORDER BY url = $2::text DESC
+LIMIT 10
 `
 
-type GetPostsForUserParams struct {
-	UserID uuid.UUID
-	Limit  int32
+type FindPostsParams struct {
+	Prefix string
+	Ref    string
 }
 
-type GetPostsForUserRow struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
-	FeedName    string
-}
-
-func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+func (q *Queries) FindPosts(ctx context.Context, arg FindPostsParams) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, findPosts, arg.Prefix, arg.Ref)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetPostsForUserRow
+	var items []Post
 	for rows.Next() {
-		var i GetPostsForUserRow
+		var i Post
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
@@ -97,7 +318,12 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
-			&i.FeedName,
+			&i.Content,
+			&i.ItunesDuration,
+			&i.ItunesEpisode,
+			&i.ItunesImage,
+			&i.ArticleContent,
+			&i.ArticleFetchedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -111,3 +337,82 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const getPost = `-- name: GetPost :one
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, content, itunes_duration, itunes_episode, itunes_image, article_content, article_fetched_at FROM posts
+WHERE id = $1
+`
+
+func (q *Queries) GetPost(ctx context.Context, id uuid.UUID) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPost, id)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Content,
+		&i.ItunesDuration,
+		&i.ItunesEpisode,
+		&i.ItunesImage,
+		&i.ArticleContent,
+		&i.ArticleFetchedAt,
+	)
+	return i, err
+}
+
+const getRecentPublishTimes = `-- name: GetRecentPublishTimes :many
+SELECT published_at FROM posts
+WHERE feed_id = $1 AND published_at IS NOT NULL
+ORDER BY published_at DESC
+LIMIT $2
+`
+
+type GetRecentPublishTimesParams struct {
+	FeedID uuid.UUID
+	Limit  int32
+}
+
+func (q *Queries) GetRecentPublishTimes(ctx context.Context, arg GetRecentPublishTimesParams) ([]sql.NullTime, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentPublishTimes, arg.FeedID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []sql.NullTime
+	for rows.Next() {
+		var published_at sql.NullTime
+		if err := rows.Scan(&published_at); err != nil {
+			return nil, err
+		}
+		items = append(items, published_at)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setPostArticle = `-- name: SetPostArticle :exec
+UPDATE posts
+SET article_content = $1, article_fetched_at = $2, updated_at = $2
+WHERE id = $3
+`
+
+type SetPostArticleParams struct {
+	ArticleContent   sql.NullString
+	ArticleFetchedAt sql.NullTime
+	ID               uuid.UUID
+}
+
+func (q *Queries) SetPostArticle(ctx context.Context, arg SetPostArticleParams) error {
+	_, err := q.db.ExecContext(ctx, setPostArticle, arg.ArticleContent, arg.ArticleFetchedAt, arg.ID)
+	return err
+}
@@ -7,20 +7,23 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name)
+-- the first user to register becomes an admin
+INSERT INTO users (id, created_at, updated_at, name, is_admin)
 VALUES (
     $1,
     $2,
     $3,
-    $4
+    $4,
+    NOT EXISTS (SELECT 1 FROM users)
 )
-RETURNING id, created_at, updated_at, name
+RETURNING id, created_at, updated_at, name, is_admin, password_hash, feed_token_hash
 `
 
 type CreateUserParams struct {
@@ -43,12 +46,15 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.IsAdmin,
+		&i.PasswordHash,
+		&i.FeedTokenHash,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, name FROM users
+SELECT id, created_at, updated_at, name, is_admin, password_hash, feed_token_hash FROM users
 WHERE name = $1
 `
 
@@ -60,6 +66,49 @@ func (q *Queries) GetUser(ctx context.Context, name string) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.IsAdmin,
+		&i.PasswordHash,
+		&i.FeedTokenHash,
+	)
+	return i, err
+}
+
+const getUserByFeedToken = `-- name: GetUserByFeedToken :one
+SELECT id, created_at, updated_at, name, is_admin, password_hash, feed_token_hash FROM users
+WHERE feed_token_hash = $1
+`
+
+func (q *Queries) GetUserByFeedToken(ctx context.Context, feedTokenHash sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByFeedToken, feedTokenHash)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.IsAdmin,
+		&i.PasswordHash,
+		&i.FeedTokenHash,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, name, is_admin, password_hash, feed_token_hash FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.IsAdmin,
+		&i.PasswordHash,
+		&i.FeedTokenHash,
 	)
 	return i, err
 }
@@ -91,6 +140,42 @@ func (q *Queries) GetUsers(ctx context.Context) ([]string, error) {
 	return items, nil
 }
 
+const listUsers = `-- name: ListUsers :many
+SELECT id, created_at, updated_at, name, is_admin, password_hash, feed_token_hash FROM users
+ORDER BY name
+`
+
+func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.IsAdmin,
+			&i.PasswordHash,
+			&i.FeedTokenHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const reset = `-- name: Reset :exec
 DELETE FROM users
 `
@@ -99,3 +184,54 @@ func (q *Queries) Reset(ctx context.Context) error {
 	_, err := q.db.ExecContext(ctx, reset)
 	return err
 }
+
+const setUserAdmin = `-- name: SetUserAdmin :exec
+UPDATE users
+SET is_admin = $1, updated_at = $2
+WHERE id = $3
+`
+
+type SetUserAdminParams struct {
+	IsAdmin   bool
+	UpdatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (q *Queries) SetUserAdmin(ctx context.Context, arg SetUserAdminParams) error {
+	_, err := q.db.ExecContext(ctx, setUserAdmin, arg.IsAdmin, arg.UpdatedAt, arg.ID)
+	return err
+}
+
+const setUserFeedToken = `-- name: SetUserFeedToken :exec
+UPDATE users
+SET feed_token_hash = $1, updated_at = $2
+WHERE id = $3
+`
+
+type SetUserFeedTokenParams struct {
+	FeedTokenHash sql.NullString
+	UpdatedAt     time.Time
+	ID            uuid.UUID
+}
+
+func (q *Queries) SetUserFeedToken(ctx context.Context, arg SetUserFeedTokenParams) error {
+	_, err := q.db.ExecContext(ctx, setUserFeedToken, arg.FeedTokenHash, arg.UpdatedAt, arg.ID)
+	return err
+}
+
+const setUserPassword = `-- name: SetUserPassword :exec
+UPDATE users
+SET password_hash = $1, updated_at = $2
+WHERE id = $3
+`
+
+type SetUserPasswordParams struct {
+	PasswordHash sql.NullString
+	UpdatedAt    time.Time
+	ID           uuid.UUID
+}
+
+func (q *Queries) SetUserPassword(ctx context.Context, arg SetUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, setUserPassword, arg.PasswordHash, arg.UpdatedAt, arg.ID)
+	return err
+}
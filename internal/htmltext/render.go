@@ -0,0 +1,256 @@
+package htmltext
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Narrowest width we'll wrap to, however small the terminal claims to be
+const minWidth = 20
+
+// Converts an HTML fragment into plain text for the terminal. Paragraphs are
+// wrapped to width columns, lists get bullets or numbers, block quotes are
+// prefixed with "> " and links are replaced by footnote markers whose URLs
+// are listed at the end. Control characters other than newlines and tabs
+// are dropped so the result is safe to print.
+func Render(src string, width int) string {
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		return StripControl(src)
+	}
+
+	r := &renderer{width: max(width, minWidth)}
+	r.walk(doc)
+	r.flush()
+
+	if len(r.links) > 0 {
+		r.out.WriteString("\n")
+		for i, link := range r.links {
+			fmt.Fprintf(&r.out, "[%d]: %s\n", i+1, link)
+		}
+	}
+	return strings.TrimRight(r.out.String(), "\n")
+}
+
+type renderer struct {
+	width     int
+	out       strings.Builder
+	inline    strings.Builder // text of the block currently being built
+	indent    []string        // line prefixes for nested quotes and lists
+	bullet    string          // marker for the first line of the next block
+	lists     []list
+	pre       int
+	links     []string
+	needBlank bool
+}
+
+type list struct {
+	ordered bool
+	n       int
+}
+
+func (r *renderer) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.DocumentNode:
+		r.children(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Iframe, atom.Object:
+		// not meant to be read
+	case atom.Br:
+		r.inline.WriteString("\n")
+	case atom.Hr:
+		r.block()
+		r.inline.WriteString(strings.Repeat("-", min(r.width, 40)))
+		r.block()
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.block()
+		level := int(n.Data[1] - '0')
+		r.inline.WriteString(strings.Repeat("#", level) + " ")
+		r.children(n)
+		r.block()
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Aside,
+		atom.Figure, atom.Figcaption, atom.Table, atom.Tr, atom.Dl, atom.Dt, atom.Dd:
+		r.block()
+		r.children(n)
+		r.block()
+	case atom.Td, atom.Th:
+		r.children(n)
+		r.inline.WriteString("  ")
+	case atom.Ul, atom.Ol:
+		// nested lists hug their parent item
+		nested := len(r.lists) > 0
+		r.flush()
+		if !nested {
+			r.needBlank = true
+		}
+		r.lists = append(r.lists, list{ordered: n.DataAtom == atom.Ol})
+		r.children(n)
+		r.lists = r.lists[:len(r.lists)-1]
+		r.flush()
+		if !nested {
+			r.needBlank = true
+		}
+	case atom.Li:
+		r.flush()
+		marker := "• "
+		if len(r.lists) > 0 {
+			l := &r.lists[len(r.lists)-1]
+			l.n++
+			if l.ordered {
+				marker = fmt.Sprintf("%d. ", l.n)
+			}
+		}
+		r.bullet = marker
+		r.indent = append(r.indent, strings.Repeat(" ", utf8.RuneCountInString(marker)))
+		r.children(n)
+		r.flush()
+		r.indent = r.indent[:len(r.indent)-1]
+	case atom.Blockquote:
+		r.block()
+		r.indent = append(r.indent, "> ")
+		r.children(n)
+		r.block()
+		r.indent = r.indent[:len(r.indent)-1]
+	case atom.Pre:
+		r.block()
+		r.pre++
+		r.children(n)
+		r.flush()
+		r.pre--
+		r.block()
+	case atom.A:
+		r.children(n)
+		href := strings.TrimSpace(StripControl(attr(n, "href")))
+		if href != "" && !strings.HasPrefix(href, "#") && href != strings.TrimSpace(textContent(n)) {
+			r.links = append(r.links, href)
+			fmt.Fprintf(&r.inline, "[%d]", len(r.links))
+		}
+	case atom.Img:
+		if alt := strings.TrimSpace(StripControl(attr(n, "alt"))); alt != "" {
+			fmt.Fprintf(&r.inline, "[image: %s]", alt)
+		}
+	default:
+		r.children(n)
+	}
+}
+
+func (r *renderer) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.walk(c)
+	}
+}
+
+func (r *renderer) text(s string) {
+	s = StripControl(s)
+	if r.pre == 0 {
+		// whitespace is collapsed when wrapping, only <br> breaks lines
+		s = strings.ReplaceAll(s, "\n", " ")
+	}
+	r.inline.WriteString(s)
+}
+
+// Ends the current block and separates it from the next by a blank line
+func (r *renderer) block() {
+	r.flush()
+	r.needBlank = true
+}
+
+// Writes out the current block's text, wrapped and prefixed
+func (r *renderer) flush() {
+	text := r.inline.String()
+	r.inline.Reset()
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+
+	if r.needBlank && r.out.Len() > 0 {
+		r.out.WriteString("\n")
+	}
+	r.needBlank = false
+
+	prefix := strings.Join(r.indent, "")
+	first := prefix
+	if r.bullet != "" && len(r.indent) > 0 {
+		first = strings.Join(r.indent[:len(r.indent)-1], "") + r.bullet
+		r.bullet = ""
+	}
+
+	if r.pre > 0 {
+		for _, line := range strings.Split(strings.Trim(text, "\n"), "\n") {
+			r.out.WriteString(strings.TrimRight(first+line, " ") + "\n")
+			first = prefix
+		}
+		return
+	}
+
+	for _, segment := range strings.Split(text, "\n") {
+		for _, line := range wrap(segment, r.width-utf8.RuneCountInString(prefix)) {
+			r.out.WriteString(first + line + "\n")
+			first = prefix
+		}
+	}
+}
+
+// Greedily wraps words to lines of at most width runes. Words longer than
+// width get a line of their own.
+func wrap(s string, width int) []string {
+	width = max(width, minWidth/2)
+	var lines []string
+	var line strings.Builder
+	lineLen := 0
+	for _, word := range strings.Fields(s) {
+		wordLen := utf8.RuneCountInString(word)
+		if lineLen > 0 && lineLen+1+wordLen > width {
+			lines = append(lines, line.String())
+			line.Reset()
+			lineLen = 0
+		}
+		if lineLen > 0 {
+			line.WriteString(" ")
+			lineLen++
+		}
+		line.WriteString(word)
+		lineLen += wordLen
+	}
+	if lineLen > 0 {
+		lines = append(lines, line.String())
+	}
+	return lines
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
@@ -0,0 +1,229 @@
+package htmltext
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Elements kept in sanitized HTML. Anything else is dropped or, if it
+// isn't in droppedElements, replaced by its contents.
+var allowedElements = map[atom.Atom]bool{
+	atom.A: true, atom.Abbr: true, atom.Address: true, atom.Article: true,
+	atom.Aside: true, atom.Audio: true, atom.B: true, atom.Bdi: true,
+	atom.Bdo: true, atom.Blockquote: true, atom.Br: true, atom.Caption: true,
+	atom.Cite: true, atom.Code: true, atom.Col: true, atom.Colgroup: true,
+	atom.Dd: true, atom.Del: true, atom.Details: true, atom.Dfn: true,
+	atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Em: true,
+	atom.Figcaption: true, atom.Figure: true, atom.Footer: true, atom.H1: true,
+	atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true,
+	atom.H6: true, atom.Header: true, atom.Hr: true, atom.I: true,
+	atom.Img: true, atom.Ins: true, atom.Kbd: true, atom.Li: true,
+	atom.Mark: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.Q: true, atom.Rp: true, atom.Rt: true, atom.Ruby: true,
+	atom.S: true, atom.Samp: true, atom.Section: true, atom.Small: true,
+	atom.Source: true, atom.Span: true, atom.Strong: true, atom.Sub: true,
+	atom.Summary: true, atom.Sup: true, atom.Table: true, atom.Tbody: true,
+	atom.Td: true, atom.Tfoot: true, atom.Th: true, atom.Thead: true,
+	atom.Time: true, atom.Tr: true, atom.U: true, atom.Ul: true,
+	atom.Var: true, atom.Video: true, atom.Wbr: true,
+}
+
+// Elements that are dropped along with everything inside them
+var droppedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Link:     true,
+	atom.Meta:     true,
+	atom.Base:     true,
+	atom.Title:    true,
+	atom.Iframe:   true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Applet:   true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Form:     true,
+	atom.Button:   true,
+	atom.Input:    true,
+	atom.Select:   true,
+	atom.Textarea: true,
+	atom.Svg:      true,
+	atom.Math:     true,
+}
+
+// Attributes kept on any allowed element
+var allowedAttributes = map[string]bool{
+	"alt":      true,
+	"title":    true,
+	"lang":     true,
+	"dir":      true,
+	"width":    true,
+	"height":   true,
+	"colspan":  true,
+	"rowspan":  true,
+	"headers":  true,
+	"scope":    true,
+	"datetime": true,
+	"start":    true,
+	"reversed": true,
+	"type":     true,
+	"controls": true,
+}
+
+// Attributes holding a URL, kept only if the URL is safe
+var urlAttributes = map[string]bool{
+	"href":   true,
+	"src":    true,
+	"cite":   true,
+	"poster": true,
+}
+
+// URL schemes links and media may use; relative URLs are allowed too
+var allowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+// URL fragments used by common feed analytics and tracking pixels
+var trackerPatterns = []string{
+	"feeds.feedburner.com/~r/",
+	"feeds.feedburner.com/~ff/",
+	"pixel.wp.com",
+	"stats.wordpress.com",
+	"doubleclick.net",
+	"google-analytics.com",
+	"/tracking/",
+	"/pixel",
+	"/beacon",
+	"mf.gif",
+}
+
+// Removes control characters other than newlines and tabs, so text from a
+// feed can't carry terminal escape sequences
+func StripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Cleans an HTML fragment before it is stored. Only known formatting
+// elements and attributes are kept, and URLs must be http, https, mailto or
+// relative. Scripts, styles, forms, embedded frames, SVG and MathML and
+// tracking pixels are removed along with their contents; other elements
+// are replaced by their contents, and control characters are stripped from
+// text. Plain text comes back HTML-escaped.
+func Sanitize(src string) string {
+	parent := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(src), parent)
+	if err != nil {
+		return html.EscapeString(src)
+	}
+	for _, n := range nodes {
+		parent.AppendChild(n)
+	}
+	cleanChildren(parent)
+
+	var b strings.Builder
+	for n := parent.FirstChild; n != nil; n = n.NextSibling {
+		err := html.Render(&b, n)
+		if err != nil {
+			return html.EscapeString(src)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func cleanChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case dropNode(c):
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode && !allowedElements[c.DataAtom]:
+			// keep the text of elements we don't know, e.g. <font>
+			cleanChildren(c)
+			for gc := c.FirstChild; gc != nil; {
+				following := gc.NextSibling
+				c.RemoveChild(gc)
+				n.InsertBefore(gc, c)
+				gc = following
+			}
+			n.RemoveChild(c)
+		case c.Type == html.TextNode:
+			c.Data = StripControl(c.Data)
+		default:
+			cleanAttributes(c)
+			cleanChildren(c)
+		}
+		c = next
+	}
+}
+
+func cleanAttributes(n *html.Node) {
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		if a.Namespace != "" {
+			continue
+		}
+		key := strings.ToLower(a.Key)
+		if allowedAttributes[key] || urlAttributes[key] && isSafeURL(a.Val) {
+			attrs = append(attrs, html.Attribute{Key: key, Val: StripControl(a.Val)})
+		}
+	}
+	n.Attr = attrs
+}
+
+func dropNode(n *html.Node) bool {
+	switch n.Type {
+	case html.CommentNode, html.DoctypeNode:
+		return true
+	case html.ElementNode:
+		// foreign content (SVG, MathML) can carry scripts and URLs in
+		// attributes we'd otherwise have to know about
+		return n.Namespace != "" || droppedElements[n.DataAtom] || isTrackingPixel(n)
+	}
+	return false
+}
+
+func isTrackingPixel(n *html.Node) bool {
+	if n.DataAtom != atom.Img {
+		return false
+	}
+	width, height := strings.TrimSpace(attr(n, "width")), strings.TrimSpace(attr(n, "height"))
+	if width == "0" || width == "1" || height == "0" || height == "1" {
+		return true
+	}
+	src := strings.ToLower(attr(n, "src"))
+	for _, pattern := range trackerPatterns {
+		if strings.Contains(src, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether a URL is relative or uses an allowed scheme. Browsers
+// ignore control characters and whitespace inside a scheme, so we do too.
+func isSafeURL(u string) bool {
+	u = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, u)
+	scheme, _, ok := strings.Cut(u, ":")
+	if !ok || strings.ContainsAny(scheme, "/?#") {
+		// no scheme, so it's relative to the page
+		return true
+	}
+	return allowedSchemes[strings.ToLower(scheme)]
+}
@@ -0,0 +1,282 @@
+// Package readability pulls the main article out of a web page, loosely
+// following the scoring approach of Arc90's Readability.
+package readability
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var ErrNoArticle = errors.New("couldn't find an article on the page")
+
+var (
+	unlikelyCandidates = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|foot|header|menu|modal|nav|popup|promo|related|remark|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|ad-break|agegate|pagination|pager`)
+	maybeCandidate     = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveNames      = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeNames      = regexp.MustCompile(`(?i)hidden|banner|combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// Elements that never hold article text
+var strippedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Iframe:   true,
+	atom.Form:     true,
+	atom.Button:   true,
+	atom.Input:    true,
+	atom.Select:   true,
+	atom.Textarea: true,
+	atom.Nav:      true,
+	atom.Aside:    true,
+	atom.Footer:   true,
+	atom.Svg:      true,
+}
+
+// Paragraphs shorter than this don't count towards a candidate's score
+const minParagraphLength = 25
+
+// Reads an HTML page and returns the HTML of its main article. Relative links
+// and image sources are resolved against pageURL.
+func Extract(r io.Reader, pageURL *url.URL) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	body := findFirst(doc, atom.Body)
+	if body == nil {
+		return "", ErrNoArticle
+	}
+
+	prune(body)
+
+	scores := map[*html.Node]float64{}
+	var candidates []*html.Node
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = initialScore(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+
+	for _, p := range findAll(body, atom.P, atom.Pre, atom.Td, atom.Blockquote) {
+		text := strings.TrimSpace(innerText(p))
+		length := utf8.RuneCountInString(text)
+		if length < minParagraphLength {
+			continue
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(length)/100, 3)
+		addScore(p.Parent, score)
+		if p.Parent != nil {
+			addScore(p.Parent.Parent, score/2)
+		}
+	}
+
+	var top *html.Node
+	for _, c := range candidates {
+		scores[c] *= 1 - linkDensity(c)
+		if top == nil || scores[c] > scores[top] {
+			top = c
+		}
+	}
+	if top == nil {
+		return "", ErrNoArticle
+	}
+
+	// siblings that score well, or are prose-like paragraphs, are usually
+	// part of the same article
+	threshold := math.Max(10, scores[top]*0.2)
+	article := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	parent := top.Parent
+	if parent == nil {
+		parent = top
+	}
+	for sibling := parent.FirstChild; sibling != nil; {
+		next := sibling.NextSibling
+		if sibling == top || keepSibling(sibling, scores, threshold) {
+			parent.RemoveChild(sibling)
+			article.AppendChild(sibling)
+		}
+		sibling = next
+	}
+
+	resolveURLs(article, pageURL)
+
+	var b strings.Builder
+	err = html.Render(&b, article)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Removes elements that can't be part of the article and unlikely candidates
+// such as sidebars and comment sections
+func prune(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && (strippedElements[c.DataAtom] || isUnlikely(c))) {
+			n.RemoveChild(c)
+		} else {
+			prune(c)
+		}
+		c = next
+	}
+}
+
+func isUnlikely(n *html.Node) bool {
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Article || n.DataAtom == atom.A {
+		return false
+	}
+	names := attr(n, "class") + " " + attr(n, "id")
+	return unlikelyCandidates.MatchString(names) && !maybeCandidate.MatchString(names)
+}
+
+func initialScore(n *html.Node) float64 {
+	var score float64
+	switch n.DataAtom {
+	case atom.Article:
+		score = 10
+	case atom.Div:
+		score = 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score = 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li:
+		score = -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score = -5
+	}
+	return score + classWeight(n)
+}
+
+func classWeight(n *html.Node) float64 {
+	var weight float64
+	for _, name := range []string{attr(n, "class"), attr(n, "id")} {
+		if name == "" {
+			continue
+		}
+		if negativeNames.MatchString(name) {
+			weight -= 25
+		}
+		if positiveNames.MatchString(name) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+func keepSibling(n *html.Node, scores map[*html.Node]float64, threshold float64) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if score, ok := scores[n]; ok && score >= threshold {
+		return true
+	}
+	if n.DataAtom != atom.P {
+		return false
+	}
+	text := innerText(n)
+	length := utf8.RuneCountInString(text)
+	density := linkDensity(n)
+	return (length > 80 && density < 0.25) || (length > 0 && density == 0 && strings.Contains(text, ". "))
+}
+
+// Fraction of a node's text that sits inside links
+func linkDensity(n *html.Node) float64 {
+	total := utf8.RuneCountInString(innerText(n))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	for _, a := range findAll(n, atom.A) {
+		linked += utf8.RuneCountInString(innerText(a))
+	}
+	return float64(linked) / float64(total)
+}
+
+func resolveURLs(n *html.Node, base *url.URL) {
+	if base == nil {
+		return
+	}
+	if n.Type == html.ElementNode {
+		for i, a := range n.Attr {
+			if a.Key != "href" && a.Key != "src" {
+				continue
+			}
+			if ref, err := url.Parse(strings.TrimSpace(a.Val)); err == nil {
+				n.Attr[i].Val = base.ResolveReference(ref).String()
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		resolveURLs(c, base)
+	}
+}
+
+func innerText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func findFirst(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findFirst(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func findAll(n *html.Node, atoms ...atom.Atom) []*html.Node {
+	var found []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode {
+				for _, a := range atoms {
+					if c.DataAtom == a {
+						found = append(found, c)
+						break
+					}
+				}
+			}
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
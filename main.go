@@ -3,8 +3,12 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,6 +17,7 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/tepidmilk/gator/internal/config"
 	"github.com/tepidmilk/gator/internal/database"
+	"github.com/tepidmilk/gator/internal/htmltext"
 )
 
 func main() {
@@ -26,42 +31,219 @@ func main() {
 	}
 	dbQueries := database.New(db)
 	s := state{
-		db:  dbQueries,
-		cfg: &cfg,
+		db:      dbQueries,
+		conn:    db,
+		cfg:     &cfg,
+		limiter: newHostLimiter(cfg.HostRequestsPerMinute, cfg.HostBurst),
 	}
 	c := commands{
-		cmd: make(map[string]func(*state, command) error),
-	}
-	c.register("login", handlerLogin)
-	c.register("register", handlerRegister)
-	c.register("reset", handlerReset)
-	c.register("users", handlerUsers)
-	c.register("agg", handlerAgg)
-	c.register("addfeed", middlewareLoggedIn(handlerAddFeed))
-	c.register("feeds", handlerFeeds)
-	c.register("follow", middlewareLoggedIn(handlerFollow))
-	c.register("following", middlewareLoggedIn(handlerFollowing))
-	c.register("unfollow", middlewareLoggedIn(handlerUnfollow))
-	c.register("browse", middlewareLoggedIn(handlerBrowse))
+		cmd: make(map[string]commandSpec),
+	}
+	registerCommands(&c)
+
 	args := os.Args
 	if len(args) < 2 {
-		log.Fatal("Usage: cli <command> [args...]")
-		return
+		c.printHelp(os.Stderr, "")
+		os.Exit(2)
 	}
-	cmd := command{
-		name: args[1],
-		args: args[2:],
-	}
-	err = c.run(&s, cmd)
-	if err != nil {
+	err = c.run(&s, args[1:])
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintln(os.Stderr, "error:", usageErr)
+		c.printUsage(os.Stderr, usageErr.cmd)
+		os.Exit(2)
+	} else if err != nil {
 		log.Fatal(err)
 	}
 }
 
+func registerCommands(c *commands) {
+	c.register("help", commandSpec{
+		args:        []string{"[command]"},
+		description: "Show the list of commands, or help for a single command",
+		handler:     c.handlerHelp,
+	})
+	c.register("completion", commandSpec{
+		args:        []string{"<bash|zsh|fish>"},
+		description: "Print a shell completion script",
+		handler:     handlerCompletion,
+	})
+	c.register("__complete", commandSpec{
+		args:    []string{"[words...]"},
+		handler: c.handlerComplete,
+		hidden:  true,
+	})
+	c.register("login", commandSpec{
+		args:        []string{"<name>"},
+		description: "Log in as an existing user",
+		handler:     handlerLogin,
+	})
+	c.register("register", commandSpec{
+		args:        []string{"<name>"},
+		description: "Create a user and log in as them",
+		handler:     handlerRegister,
+	})
+	c.register("logout", commandSpec{
+		description: "End the current session",
+		handler:     handlerLogout,
+	})
+	c.register("passwd", commandSpec{
+		description: "Set, change or remove your password",
+		handler:     middlewareLoggedIn(handlerPasswd),
+	})
+	c.register("reset", commandSpec{
+		description: "Delete all users, feeds and posts",
+		handler:     handlerReset,
+	})
+	c.register("users", commandSpec{
+		description: "List all users",
+		handler:     handlerUsers,
+	})
+	c.register("agg", commandSpec{
+		args:        []string{"[default_interval]"},
+		description: "Keep fetching feeds as they fall due; new feeds are polled every default_interval (1h)",
+		handler:     handlerAgg,
+	})
+	c.register("addfeed", commandSpec{
+		args:        []string{"<Feed Name>", "<URL>"},
+		description: "Add a feed and follow it",
+		handler:     middlewareLoggedIn(handlerAddFeed),
+	})
+	c.register("feeds", commandSpec{
+		description: "List all feeds",
+		handler:     handlerFeeds,
+	})
+	c.register("feedinfo", commandSpec{
+		args:        []string{"<feed>"},
+		description: "Show everything known about a feed",
+		handler:     handlerFeedInfo,
+	})
+	c.register("rmfeed", commandSpec{
+		args:        []string{"<feed>"},
+		description: "Delete a feed along with its posts",
+		handler:     middlewareLoggedIn(handlerRmFeed),
+	})
+	c.register("renamefeed", commandSpec{
+		args:        []string{"<feed>", "<New Name>"},
+		description: "Rename a feed",
+		handler:     middlewareLoggedIn(handlerRenameFeed),
+	})
+	c.register("movefeed", commandSpec{
+		args:        []string{"<feed>", "<New URL>"},
+		description: "Point a feed at a new URL, keeping its posts and followers",
+		handler:     middlewareLoggedIn(handlerMoveFeed),
+	})
+	c.register("admin", commandSpec{
+		args:        []string{"<name>", "<on|off>"},
+		description: "Grant or revoke a user's admin rights",
+		handler:     middlewareLoggedIn(handlerAdmin),
+	})
+	c.register("follow", commandSpec{
+		args:        []string{"<feed>"},
+		description: "Follow a feed",
+		handler:     middlewareLoggedIn(handlerFollow),
+	})
+	c.register("following", commandSpec{
+		description: "List the feeds you follow",
+		handler:     middlewareLoggedIn(handlerFollowing),
+	})
+	c.register("unfollow", commandSpec{
+		args:        []string{"<feed>"},
+		description: "Unfollow a feed",
+		handler:     middlewareLoggedIn(handlerUnfollow),
+	})
+	c.register("browse", commandSpec{
+		args:        []string{"[limit]"},
+		description: "Show the latest posts from feeds you follow, a page of 10 at a time",
+		flags: func(f *flag.FlagSet) {
+			f.Bool("full", false, "show each post's full article instead of its summary")
+			f.String("author", "", "only show posts by this author")
+			f.String("category", "", "only show posts in this category")
+			f.String("feed", "", "only show posts from this feed")
+			f.String("since", "", "only show posts published since a date (2024-05-01) or age (7d, 36h)")
+			f.String("until", "", "only show posts published before a date or age")
+			f.String("sort", sortNewest, "show the newest or oldest posts first")
+			f.String("cursor", "", "continue from where the previous page left off")
+		},
+		handler: middlewareLoggedIn(handlerBrowse),
+	})
+	c.register("addkey", commandSpec{
+		args:        []string{"[name]"},
+		description: "Create an API key for the serve API",
+		handler:     middlewareLoggedIn(handlerAddKey),
+	})
+	c.register("keys", commandSpec{
+		description: "List your API keys",
+		handler:     middlewareLoggedIn(handlerKeys),
+	})
+	c.register("revokekey", commandSpec{
+		args:        []string{"<key>"},
+		description: "Revoke one of your API keys",
+		handler:     middlewareLoggedIn(handlerRevokeKey),
+	})
+	c.register("feedurl", commandSpec{
+		description: "Create a secret RSS and Atom feed of everything you follow",
+		handler:     middlewareLoggedIn(handlerFeedURL),
+	})
+	c.register("serve", commandSpec{
+		description: "Serve the REST API and web reader",
+		flags: func(f *flag.FlagSet) {
+			f.String("addr", defaultServeAddr, "address to listen on")
+		},
+		handler: handlerServe,
+	})
+	c.register("tui", commandSpec{
+		description: "Read the feeds you follow in an interactive terminal reader",
+		handler:     middlewareLoggedIn(handlerTUI),
+	})
+	c.register("download", commandSpec{
+		args:        []string{"<post>"},
+		description: "Download a post's enclosures",
+		handler:     handlerDownload,
+	})
+	c.register("fetcharticle", commandSpec{
+		args:        []string{"<post>"},
+		description: "Extract and store the article a post links to",
+		handler:     handlerFetchArticle,
+	})
+	c.register("feedarticles", commandSpec{
+		args:        []string{"<feed>", "<on|off>"},
+		description: "Turn article extraction for a feed's new posts on or off",
+		handler:     middlewareLoggedIn(handlerFeedArticles),
+	})
+	c.register("star", commandSpec{
+		args:        []string{"<post>"},
+		description: "Star a post so it's never pruned",
+		handler:     middlewareLoggedIn(handlerStar),
+	})
+	c.register("unstar", commandSpec{
+		args:        []string{"<post>"},
+		description: "Unstar a post",
+		handler:     middlewareLoggedIn(handlerUnstar),
+	})
+	c.register("markread", commandSpec{
+		args:        []string{"<post>"},
+		description: "Mark a post read",
+		flags: func(f *flag.FlagSet) {
+			f.Bool("unread", false, "mark the post unread again")
+		},
+		handler: middlewareLoggedIn(handlerMarkRead),
+	})
+	c.register("prune", commandSpec{
+		description: "Delete posts outside the retention policy",
+		handler:     handlerPrune,
+	})
+	c.register("feedretention", commandSpec{
+		args:        []string{"<feed>", "<max_age_days>", "<max_posts>"},
+		description: "Set a feed's retention policy; 0 uses the global setting",
+		handler:     middlewareLoggedIn(handlerFeedRetention),
+	})
+}
+
 // takes a handler that requires a logged in user and returns a normal handler to register
 func middlewareLoggedIn(handler func(s *state, cmd command, user database.User) error) func(*state, command) error {
 	return func(s *state, cmd command) error {
-		user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUserName)
+		user, err := currentUser(s)
 		if err != nil {
 			return err
 		}
@@ -70,57 +252,246 @@ func middlewareLoggedIn(handler func(s *state, cmd command, user database.User)
 	}
 }
 
-func scrapeFeeds(s *state) {
-	nextFeed, err := s.db.GetNextFeedToFetch(context.Background())
-	if err != nil {
+// Fetches the next due feed, if any, and reports whether one was fetched.
+// Feeds without enough posting history are polled every defaultInterval.
+func scrapeFeeds(s *state, defaultInterval time.Duration) bool {
+	now := time.Now().UTC()
+	nextFeed, err := s.db.GetNextFeedToFetch(context.Background(), sql.NullTime{Time: now, Valid: true})
+	if err == sql.ErrNoRows {
+		// nothing is due yet
+		return false
+	} else if err != nil {
 		log.Println("error getting next feed to fetch:", err)
-		return
+		return false
+	}
+
+	// if the feed's host has had its share of requests, the feed waits its
+	// turn while feeds on other hosts are fetched
+	delay, err := s.limiter.tryTake(nextFeed.Url)
+	if err != nil {
+		log.Printf("error rate limiting %s: %v", nextFeed.Name, err)
+	} else if delay > 0 {
+		err = s.db.SetFeedNextFetch(context.Background(), database.SetFeedNextFetchParams{
+			NextFetchAt: sql.NullTime{Time: now.Add(delay), Valid: true},
+			ID:          nextFeed.ID,
+		})
+		if err != nil {
+			log.Println("error scheduling next fetch:", err)
+			return false
+		}
+		return true
 	}
 
+	// if the fetch fails the feed is retried after the default interval
 	err = s.db.MarkFeedFetched(context.Background(), database.MarkFeedFetchedParams{
-		LastFethcedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		LastFethcedAt: sql.NullTime{Time: now, Valid: true},
+		NextFetchAt:   sql.NullTime{Time: now.Add(defaultInterval), Valid: true},
 		ID:            nextFeed.ID,
 	})
 	if err != nil {
 		log.Println("error marking feed fetched:", err)
-		return
+		return false
 	}
 
 	RSSFeed, err := fetchFeed(context.Background(), nextFeed.Url)
-	if err != nil {
+	var retryErr *retryAfterError
+	if errors.As(err, &retryErr) {
+		log.Printf("%s asked us to back off: %v", nextFeed.Name, err)
+		err = s.db.SetFeedNextFetch(context.Background(), database.SetFeedNextFetchParams{
+			NextFetchAt: sql.NullTime{Time: retryErr.retryAt, Valid: true},
+			ID:          nextFeed.ID,
+		})
+		if err != nil {
+			log.Println("error scheduling next fetch:", err)
+		}
+		return true
+	} else if err != nil {
 		log.Println("error fetching feed:", err)
-		return
+		return true
 	}
 
-	for _, item := range RSSFeed.Channel.Item {
+	ingestFeed(s, nextFeed, RSSFeed)
+
+	scheduleNextFetch(s, nextFeed, RSSFeed, now, defaultInterval)
+	return true
+}
+
+// Stores a parsed feed's metadata and posts. This is shared by polling and
+// by content pushed to us from a WebSub hub.
+func ingestFeed(s *state, feed database.Feed, rss *RSSFeed) {
+	err := s.db.UpdateFeedMetadata(context.Background(), database.UpdateFeedMetadataParams{
+		SiteLink:    toNullString(rss.Channel.Link),
+		Description: toNullString(rss.Channel.Description),
+		Language:    toNullString(rss.Channel.Language),
+		ImageUrl:    toNullString(rss.Channel.Image.URL),
+		Generator:   toNullString(rss.Channel.Generator),
+		UpdatedAt:   time.Now().UTC(),
+		ID:          feed.ID,
+	})
+	if err != nil {
+		log.Println("error updating feed metadata:", err)
+	}
+
+	for _, item := range rss.Channel.Item {
 		publishTime, err := dateparse.ParseAny(item.PubDate)
 		if err != nil {
 			log.Println("error parsing item's time:", err)
-			return
+			continue
 		}
+		postID := uuid.New()
 		err = s.db.CreatePost(context.Background(), database.CreatePostParams{
-			ID:        uuid.New(),
+			ID:        postID,
 			CreatedAt: time.Now().UTC(),
 			UpdatedAt: time.Now().UTC(),
 			Title:     item.Title,
 			Url:       item.Link,
 			Description: sql.NullString{
-				String: item.Description,
+				String: htmltext.Sanitize(item.Description),
 				Valid:  true,
 			},
 			PublishedAt: sql.NullTime{
 				Time:  publishTime,
 				Valid: true,
 			},
-			FeedID: nextFeed.ID,
+			FeedID:         feed.ID,
+			Content:        toNullString(htmltext.Sanitize(item.Content)),
+			ItunesDuration: toNullString(item.ItunesDuration),
+			ItunesEpisode:  toNullInt32(item.ItunesEpisode),
+			ItunesImage:    toNullString(item.ItunesImage.Href),
 		})
 		if err != nil {
-			if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			if isUniqueViolation(err) {
+				postsDuplicated.Inc()
 				continue
 			}
+			log.Printf("couldn't create post: %v", err)
+			continue
+		}
+		postsInserted.Inc()
+
+		if feed.FetchArticles && item.Link != "" {
+			// extracted later by agg's article worker
+			err = s.db.QueueArticle(context.Background(), database.QueueArticleParams{
+				PostID:   postID,
+				QueuedAt: time.Now().UTC(),
+			})
+			if err != nil {
+				log.Printf("couldn't queue article for %s: %v", item.Link, err)
+			}
+		}
+
+		for _, name := range item.authorNames() {
+			authorID, err := s.db.UpsertAuthor(context.Background(), database.UpsertAuthorParams{
+				ID:        uuid.New(),
+				CreatedAt: time.Now().UTC(),
+				UpdatedAt: time.Now().UTC(),
+				Name:      name,
+			})
+			if err == nil {
+				err = s.db.AddPostAuthor(context.Background(), database.AddPostAuthorParams{PostID: postID, AuthorID: authorID})
+			}
+			if err != nil {
+				log.Printf("couldn't save author: %v", err)
+			}
+		}
+
+		for _, name := range item.categoryNames() {
+			categoryID, err := s.db.UpsertCategory(context.Background(), database.UpsertCategoryParams{
+				ID:        uuid.New(),
+				CreatedAt: time.Now().UTC(),
+				UpdatedAt: time.Now().UTC(),
+				Name:      name,
+			})
+			if err == nil {
+				err = s.db.AddPostCategory(context.Background(), database.AddPostCategoryParams{PostID: postID, CategoryID: categoryID})
+			}
+			if err != nil {
+				log.Printf("couldn't save category: %v", err)
+			}
+		}
+
+		for _, enclosure := range item.Enclosures {
+			if enclosure.URL == "" {
+				continue
+			}
+			err = s.db.CreatePostEnclosure(context.Background(), database.CreatePostEnclosureParams{
+				ID:        uuid.New(),
+				CreatedAt: time.Now().UTC(),
+				UpdatedAt: time.Now().UTC(),
+				PostID:    postID,
+				Url:       enclosure.URL,
+				MimeType:  toNullString(enclosure.Type),
+				Length:    toNullInt64(enclosure.Length),
+			})
+			if err != nil {
+				log.Printf("couldn't save enclosure: %v", err)
+			}
+		}
+	}
+	log.Printf("Feed %s collectedm %v posts found", feed.Name, len(rss.Channel.Item))
+
+	discoverHub(s, feed, rss)
+}
+
+// Learns the feed's polling interval from its posting history and schedules
+// its next fetch, deferring further if the publisher asks us to.
+func scheduleNextFetch(s *state, feed database.Feed, rss *RSSFeed, fetchedAt time.Time, defaultInterval time.Duration) {
+	recent, err := s.db.GetRecentPublishTimes(context.Background(), database.GetRecentPublishTimesParams{
+		FeedID: feed.ID,
+		Limit:  cadenceSampleSize,
+	})
+	if err != nil {
+		log.Println("error getting feed's posting history:", err)
+	}
+	published := make([]time.Time, 0, len(recent))
+	for _, t := range recent {
+		if t.Valid {
+			published = append(published, t.Time)
 		}
-		log.Printf("couldn't create post: %v", err)
-		continue
 	}
-	log.Printf("Feed %s collectedm %v posts found", nextFeed.Name, len(RSSFeed.Channel.Item))
+
+	interval := pollInterval(published, fetchedAt, defaultInterval)
+	err = s.db.SetFeedPollInterval(context.Background(), database.SetFeedPollIntervalParams{
+		PollIntervalSeconds: sql.NullInt32{Int32: int32(interval / time.Second), Valid: true},
+		ID:                  feed.ID,
+	})
+	if err != nil {
+		log.Println("error saving poll interval:", err)
+	}
+
+	// a hub pushes new posts to us, so polling is only a safety net
+	if websubActive(s, feed.ID) {
+		interval = maxPollInterval
+	}
+
+	err = s.db.SetFeedNextFetch(context.Background(), database.SetFeedNextFetchParams{
+		NextFetchAt: sql.NullTime{Time: rss.nextFetchTime(fetchedAt, interval), Valid: true},
+		ID:          feed.ID,
+	})
+	if err != nil {
+		log.Println("error scheduling next fetch:", err)
+	}
+}
+
+// reports whether err is Postgres refusing a row that breaks a unique constraint
+func isUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint")
+}
+
+// returns a NullString that is only valid when s is non-empty
+func toNullString(s string) sql.NullString {
+	s = strings.TrimSpace(s)
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// returns a NullInt32 that is only valid when s holds an integer
+func toNullInt32(s string) sql.NullInt32 {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+	return sql.NullInt32{Int32: int32(n), Valid: err == nil}
+}
+
+// returns a NullInt64 that is only valid when s holds a positive integer
+func toNullInt64(s string) sql.NullInt64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	return sql.NullInt64{Int64: n, Valid: err == nil && n > 0}
 }
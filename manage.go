@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tepidmilk/gator/internal/database"
+	"github.com/tepidmilk/gator/internal/htmltext"
+)
+
+// Delete a feed along with its posts and follows
+func handlerRmFeed(s *state, cmd command, user database.User) error {
+	feed, err := managedFeed(s, user, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	err = s.db.DeleteFeed(context.Background(), feed.ID)
+	if err != nil {
+		return fmt.Errorf("error deleting feed: %v", err)
+	}
+
+	fmt.Printf("Deleted feed %s\n", htmltext.StripControl(feed.Name))
+	return nil
+}
+
+func handlerRenameFeed(s *state, cmd command, user database.User) error {
+	feed, err := managedFeed(s, user, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	err = s.db.RenameFeed(context.Background(), database.RenameFeedParams{
+		Name:      cmd.args[1],
+		UpdatedAt: time.Now().UTC(),
+		ID:        feed.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("error renaming feed: %v", err)
+	}
+
+	fmt.Printf("Renamed %s to %s\n", htmltext.StripControl(feed.Name), cmd.args[1])
+	return nil
+}
+
+// Point a feed at a new URL when its publisher relocates it, keeping its
+// posts and followers
+func handlerMoveFeed(s *state, cmd command, user database.User) error {
+	feed, err := managedFeed(s, user, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	_, err = s.db.GetFeedByURL(context.Background(), cmd.args[1])
+	if err == nil {
+		return fmt.Errorf("a feed already exists at %s", cmd.args[1])
+	} else if err != sql.ErrNoRows {
+		return fmt.Errorf("error checking new URL: %v", err)
+	}
+
+	err = s.db.SetFeedURL(context.Background(), database.SetFeedURLParams{
+		Url:       cmd.args[1],
+		UpdatedAt: time.Now().UTC(),
+		ID:        feed.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("error moving feed: %v", err)
+	}
+	// the hub subscription was for the old URL; the next fetch rediscovers it
+	err = s.db.DeleteWebSubSubscriptionForFeed(context.Background(), feed.ID)
+	if err != nil {
+		return fmt.Errorf("error removing WebSub subscription: %v", err)
+	}
+
+	fmt.Printf("Moved %s to %s\n", htmltext.StripControl(feed.Name), cmd.args[1])
+	return nil
+}
+
+// Grant or revoke another user's admin rights
+func handlerAdmin(s *state, cmd command, user database.User) error {
+	if cmd.args[1] != "on" && cmd.args[1] != "off" {
+		return cmd.usageErrorf("expected on or off, got '%s'", cmd.args[1])
+	}
+	if !user.IsAdmin {
+		return errors.New("only admins can change admin rights")
+	}
+
+	target, err := s.db.GetUser(context.Background(), cmd.args[0])
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no user named %s", cmd.args[0])
+	} else if err != nil {
+		return err
+	}
+	err = s.db.SetUserAdmin(context.Background(), database.SetUserAdminParams{
+		IsAdmin:   cmd.args[1] == "on",
+		UpdatedAt: time.Now().UTC(),
+		ID:        target.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("error updating user: %v", err)
+	}
+
+	fmt.Printf("Admin rights turned %s for %s\n", cmd.args[1], target.Name)
+	return nil
+}
+
+// Looks up a feed, making sure the user may change it: only the feed's
+// creator and admins can
+func managedFeed(s *state, user database.User, ref string) (database.FindFeedsRow, error) {
+	feed, err := resolveFeed(s, ref)
+	if err != nil {
+		return feed, err
+	}
+	if feed.UserID != user.ID && !user.IsAdmin {
+		return feed, fmt.Errorf("only %s or an admin can change this feed", feed.UserName)
+	}
+	return feed, nil
+}
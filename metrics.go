@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics agg exposes on /metrics when metrics_listen_addr is set
+var (
+	feedFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gator_feed_fetches_total",
+		Help: "Feed fetches by HTTP status, or \"error\" when no response came back.",
+	}, []string{"status"})
+	feedFetchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gator_feed_fetch_duration_seconds",
+		Help:    "Time taken to fetch a feed, including reading its body.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+	})
+	feedFetchBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gator_feed_fetch_bytes_total",
+		Help: "Bytes of feed documents downloaded.",
+	})
+	feedParseFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gator_feed_parse_failures_total",
+		Help: "Fetched or pushed feed documents that couldn't be parsed.",
+	})
+	postsInserted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gator_posts_inserted_total",
+		Help: "New posts stored.",
+	})
+	postsDuplicated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gator_posts_duplicated_total",
+		Help: "Posts skipped because they were already stored.",
+	})
+)
+
+// Records a finished fetch attempt
+func observeFetch(status int, start time.Time) {
+	label := "error"
+	if status != 0 {
+		label = strconv.Itoa(status)
+	}
+	feedFetches.WithLabelValues(label).Inc()
+	feedFetchDuration.Observe(time.Since(start).Seconds())
+}
+
+// Serves /metrics, plus /healthz and /readyz for probes, alongside agg
+func startMetrics(s *state, addr string) {
+	// how far behind the scheduler is: how long the most overdue feed has
+	// been due. Feeds are polled as rarely as every 2 days, so the age of
+	// the last fetch says nothing about whether any are late.
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "gator_fetch_queue_lag_seconds",
+		Help: "How long the most overdue feed has been due for a fetch; 0 when none are.",
+	}, func() float64 {
+		now := time.Now().UTC()
+		dueAt, err := s.db.GetOldestDueTime(context.Background(), sql.NullTime{Time: now, Valid: true})
+		if err != nil {
+			return 0
+		}
+		return max(now.Sub(dueAt).Seconds(), 0)
+	}))
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	registerHealth(mux, s, true)
+	go func() {
+		fmt.Printf("Serving metrics on %s\n", addr)
+		err := http.ListenAndServe(addr, mux)
+		log.Println("metrics server stopped:", err)
+	}()
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tepidmilk/gator/internal/database"
+)
+
+// Posts included in a user's merged feed
+const outputFeedSize = 50
+
+// How long readers may cache a merged feed before checking it again
+const outputFeedMaxAge = 5 * time.Minute
+
+type rssOutput struct {
+	XMLName xml.Name         `xml:"rss"`
+	Version string           `xml:"version,attr"`
+	AtomNS  string           `xml:"xmlns:atom,attr"`
+	Channel rssOutputChannel `xml:"channel"`
+}
+
+type rssOutputChannel struct {
+	Title         string          `xml:"title"`
+	Link          string          `xml:"link"`
+	Description   string          `xml:"description"`
+	SelfLink      atomOutputLink  `xml:"atom:link"`
+	LastBuildDate string          `xml:"lastBuildDate"`
+	Generator     string          `xml:"generator"`
+	Items         []rssOutputItem `xml:"item"`
+}
+
+type rssOutputItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssOutputGUID `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Description string        `xml:"description,omitempty"`
+	Category    string        `xml:"category"`
+}
+
+type rssOutputGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomOutput struct {
+	XMLName xml.Name         `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string           `xml:"id"`
+	Title   string           `xml:"title"`
+	Updated string           `xml:"updated"`
+	Author  atomOutputPerson `xml:"author"`
+	Links   []atomOutputLink `xml:"link"`
+	Entries []atomOutputItem `xml:"entry"`
+}
+
+type atomOutputPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomOutputLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomOutputItem struct {
+	ID        string             `xml:"id"`
+	Title     string             `xml:"title"`
+	Link      atomOutputLink     `xml:"link"`
+	Published string             `xml:"published,omitempty"`
+	Updated   string             `xml:"updated"`
+	Category  atomOutputCategory `xml:"category"`
+	Summary   *atomOutputText    `xml:"summary"`
+	Content   *atomOutputText    `xml:"content"`
+}
+
+type atomOutputCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomOutputText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Give the current user a new secret URL for their merged feed. Any
+// previous URL stops working.
+func handlerFeedURL(s *state, cmd command, user database.User) error {
+	token, err := randomToken("")
+	if err != nil {
+		return fmt.Errorf("error generating feed token: %v", err)
+	}
+	err = s.db.SetUserFeedToken(context.Background(), database.SetUserFeedTokenParams{
+		FeedTokenHash: sql.NullString{String: hashToken(token), Valid: true},
+		UpdatedAt:     time.Now().UTC(),
+		ID:            user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("error saving feed token: %v", err)
+	}
+
+	base := publicURL(s, defaultServeAddr)
+	fmt.Println("Subscribe to everything you follow at one of these URLs. Keep them secret:")
+	fmt.Printf("  RSS:  %s/feed/%s/rss.xml\n", base, token)
+	fmt.Printf("  Atom: %s/feed/%s/atom.xml\n", base, token)
+	return nil
+}
+
+// The base URL serve is reachable at: the configured public URL, else the
+// address it listens on. The request's Host header is never trusted for
+// this, since the client chooses it.
+func publicURL(s *state, addr string) string {
+	if s.cfg.PublicURL != "" {
+		return strings.TrimSuffix(s.cfg.PublicURL, "/")
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port, _ = net.SplitHostPort(defaultServeAddr)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// Serves a user's merged timeline as RSS or Atom, found by the secret
+// token in its URL rather than an API key so any reader can subscribe
+func (api *apiServer) handleOutputFeed(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.PathValue("token")
+		user, err := api.s.db.GetUserByFeedToken(r.Context(), sql.NullString{String: hashToken(token), Valid: true})
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			writeAPIError(w, fmt.Errorf("error getting feed owner: %v", err))
+			return
+		}
+		posts, err := api.s.db.BrowsePostsNewest(r.Context(), database.BrowsePostsNewestParams{
+			UserID:   user.ID,
+			MaxPosts: outputFeedSize,
+		})
+		if err != nil {
+			writeAPIError(w, fmt.Errorf("error getting posts for user: %v", err))
+			return
+		}
+
+		// the feed changes whenever a post is added, updated or drops out
+		// because its feed was unfollowed; the ETag covers all three
+		updated := user.CreatedAt
+		etag := sha256.New()
+		fmt.Fprintln(etag, format)
+		for _, post := range posts {
+			updated = latest(updated, post.UpdatedAt)
+			fmt.Fprintln(etag, post.ID, post.UpdatedAt.UnixNano())
+		}
+
+		base := api.baseURL
+		self := base + r.URL.Path
+		var body []byte
+		if format == "atom" {
+			body, err = renderAtom(user, posts, base, self, updated)
+			w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		} else {
+			body, err = renderRSS(user, posts, base, self, updated)
+			w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		}
+		if err != nil {
+			writeAPIError(w, fmt.Errorf("error rendering feed: %v", err))
+			return
+		}
+
+		// the URL is a secret, so shared caches mustn't keep it
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(outputFeedMaxAge/time.Second)))
+		w.Header().Set("ETag", `"`+hex.EncodeToString(etag.Sum(nil))[:32]+`"`)
+		// answers If-None-Match with 304 Not Modified. There's no
+		// Last-Modified: unfollowing a feed changes the feed without making
+		// it any newer, so If-Modified-Since would serve stale copies.
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+	}
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// The post's body for readers: the full content when we have it, else
+// the summary
+func outputFeedBody(post database.BrowsePostsNewestRow) (summary, content string) {
+	if post.ArticleContent.Valid {
+		content = post.ArticleContent.String
+	} else if post.Content.Valid {
+		content = post.Content.String
+	}
+	return post.Description.String, content
+}
+
+func renderRSS(user database.User, posts []database.BrowsePostsNewestRow, base, self string, updated time.Time) ([]byte, error) {
+	feed := rssOutput{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssOutputChannel{
+			Title:         fmt.Sprintf("%s's feeds", user.Name),
+			Link:          base,
+			Description:   fmt.Sprintf("Posts from every feed %s follows in gator", user.Name),
+			SelfLink:      atomOutputLink{Href: self, Rel: "self", Type: "application/rss+xml"},
+			LastBuildDate: updated.UTC().Format(time.RFC1123Z),
+			Generator:     "gator",
+		},
+	}
+	for _, post := range posts {
+		summary, content := outputFeedBody(post)
+		if content != "" {
+			summary = content
+		}
+		feed.Channel.Items = append(feed.Channel.Items, rssOutputItem{
+			Title:       post.Title,
+			Link:        post.Url,
+			GUID:        rssOutputGUID{IsPermaLink: "false", Value: "urn:uuid:" + post.ID.String()},
+			PubDate:     sortTime(post).UTC().Format(time.RFC1123Z),
+			Description: summary,
+			Category:    post.FeedName,
+		})
+	}
+	return marshalXML(feed)
+}
+
+func renderAtom(user database.User, posts []database.BrowsePostsNewestRow, base, self string, updated time.Time) ([]byte, error) {
+	feed := atomOutput{
+		ID:      "urn:uuid:" + user.ID.String(),
+		Title:   fmt.Sprintf("%s's feeds", user.Name),
+		Updated: updated.UTC().Format(time.RFC3339),
+		Author:  atomOutputPerson{Name: user.Name},
+		Links: []atomOutputLink{
+			{Href: self, Rel: "self", Type: "application/atom+xml"},
+			{Href: base, Rel: "alternate"},
+		},
+	}
+	for _, post := range posts {
+		entry := atomOutputItem{
+			ID:       "urn:uuid:" + post.ID.String(),
+			Title:    post.Title,
+			Link:     atomOutputLink{Href: post.Url, Rel: "alternate"},
+			Updated:  post.UpdatedAt.UTC().Format(time.RFC3339),
+			Category: atomOutputCategory{Term: post.FeedName},
+		}
+		if post.PublishedAt.Valid {
+			entry.Published = post.PublishedAt.Time.UTC().Format(time.RFC3339)
+		}
+		summary, content := outputFeedBody(post)
+		if summary != "" {
+			entry.Summary = &atomOutputText{Type: "html", Value: summary}
+		}
+		if content != "" {
+			entry.Content = &atomOutputText{Type: "html", Value: content}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return marshalXML(feed)
+}
+
+func marshalXML(v any) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
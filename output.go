@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Formats for --output; without it listings are printed for humans
+const (
+	outputJSON  = "json"
+	outputCSV   = "csv"
+	outputTable = "table"
+)
+
+// Writes a slice of record structs in the given format. Field names come
+// from the structs' json tags; fields tagged `table:"-"` are left out of
+// tables, where they'd be too long to read.
+func writeRecords(w io.Writer, format string, records any) error {
+	v := reflect.ValueOf(records)
+	t := v.Type().Elem()
+
+	if format == outputJSON {
+		if v.Len() == 0 {
+			// an empty list rather than null
+			v = reflect.MakeSlice(v.Type(), 0, 0)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v.Interface())
+	}
+
+	var columns []int
+	var header []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if format == outputTable && field.Tag.Get("table") == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		columns = append(columns, i)
+		header = append(header, name)
+	}
+	rows := make([][]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		row := make([]string, 0, len(columns))
+		for _, column := range columns {
+			row = append(row, formatField(v.Index(i).Field(column)))
+		}
+		rows = append(rows, row)
+	}
+
+	switch format {
+	case outputCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return cw.Error()
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unknown output format '%s'", format)
+}
+
+// Renders a record field as a CSV or table cell
+func formatField(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch value := v.Interface().(type) {
+	case time.Time:
+		return value.Format(time.RFC3339)
+	case []string:
+		return strings.Join(value, ", ")
+	case bool:
+		return strconv.FormatBool(value)
+	case string:
+		// keep each record on a single line
+		return strings.Join(strings.Fields(value), " ")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// Returns a pointer to the time when it's set, for nullable record fields
+func timeOrNil(t time.Time, valid bool) *time.Time {
+	if !valid {
+		return nil
+	}
+	return &t
+}
+
+func stringOrNil(s string, valid bool) *string {
+	if !valid {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/google/uuid"
+	"github.com/tepidmilk/gator/internal/database"
+)
+
+// Orders posts can be browsed in
+const (
+	sortNewest = "newest"
+	sortOldest = "oldest"
+)
+
+// Fetches a page of a user's posts in the given order. Pages are keyed on
+// each post's publish time and ID, so set params.CursorTime and CursorID
+// from the last post of the previous page to get the next one.
+func browsePosts(s *state, params database.BrowsePostsNewestParams, order string) ([]database.BrowsePostsNewestRow, error) {
+	if order != sortOldest {
+		return s.db.BrowsePostsNewest(context.Background(), params)
+	}
+
+	rows, err := s.db.BrowsePostsOldest(context.Background(), database.BrowsePostsOldestParams(params))
+	if err != nil {
+		return nil, err
+	}
+	posts := make([]database.BrowsePostsNewestRow, 0, len(rows))
+	for _, row := range rows {
+		posts = append(posts, database.BrowsePostsNewestRow(row))
+	}
+	return posts, nil
+}
+
+// The time posts are sorted by; posts without a publish date sort by when
+// we first saw them
+func sortTime(post database.BrowsePostsNewestRow) time.Time {
+	if post.PublishedAt.Valid {
+		return post.PublishedAt.Time
+	}
+	return post.CreatedAt
+}
+
+// Encodes the position just after a post as an opaque cursor
+func encodeCursor(post database.BrowsePostsNewestRow) string {
+	key := sortTime(post).UTC().Format(time.RFC3339Nano) + "|" + post.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (time.Time, uuid.UUID, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, fmt.Errorf("invalid cursor '%s'", cursor)
+	}
+	timePart, idPart, ok := strings.Cut(string(key), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, fmt.Errorf("invalid cursor '%s'", cursor)
+	}
+	t, err := time.Parse(time.RFC3339Nano, timePart)
+	if err != nil {
+		return time.Time{}, uuid.Nil, fmt.Errorf("invalid cursor '%s'", cursor)
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil {
+		return time.Time{}, uuid.Nil, fmt.Errorf("invalid cursor '%s'", cursor)
+	}
+	return t, id, nil
+}
+
+// Parses --since and --until values: either a date such as 2024-05-01 or
+// an age such as 36h or 7d, counted back from now
+func parseTimeFilter(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if age, err := time.ParseDuration(value); err == nil && age >= 0 {
+		return now.Add(-age), nil
+	}
+	t, err := dateparse.ParseLocal(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date or an age like 7d, got '%s'", value)
+	}
+	return t.UTC(), nil
+}
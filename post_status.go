@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tepidmilk/gator/internal/database"
+	"github.com/tepidmilk/gator/internal/htmltext"
+)
+
+// Star a post so it's never pruned
+func handlerStar(s *state, cmd command, user database.User) error {
+	post, err := resolvePost(s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	err = s.db.StarPost(context.Background(), database.StarPostParams{
+		UserID:    user.ID,
+		PostID:    post.ID,
+		StarredAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("error starring post: %v", err)
+	}
+
+	fmt.Printf("Starred '%s'\n", htmltext.StripControl(post.Title))
+	return nil
+}
+
+func handlerUnstar(s *state, cmd command, user database.User) error {
+	post, err := resolvePost(s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	err = s.db.UnstarPost(context.Background(), database.UnstarPostParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("error unstarring post: %v", err)
+	}
+
+	fmt.Printf("Unstarred '%s'\n", htmltext.StripControl(post.Title))
+	return nil
+}
+
+// Mark a post read, or unread again with --unread
+func handlerMarkRead(s *state, cmd command, user database.User) error {
+	post, err := resolvePost(s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	if cmd.boolFlag("unread") {
+		err = s.db.MarkPostUnread(context.Background(), database.MarkPostUnreadParams{
+			UserID: user.ID,
+			PostID: post.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("error marking post unread: %v", err)
+		}
+		fmt.Printf("Marked '%s' unread\n", htmltext.StripControl(post.Title))
+		return nil
+	}
+
+	err = s.db.MarkPostRead(context.Background(), database.MarkPostReadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+		ReadAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("error marking post read: %v", err)
+	}
+
+	fmt.Printf("Marked '%s' read\n", htmltext.StripControl(post.Title))
+	return nil
+}
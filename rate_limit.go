@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults used when the config doesn't set a per-host rate
+const (
+	defaultHostRequestsPerMinute = 6
+	defaultHostBurst             = 1
+)
+
+// Longest we'll let a Retry-After header push back a feed
+const maxRetryAfter = 24 * time.Hour
+
+// A token bucket per hostname so that feeds living on the same host
+// (Medium, Substack, ...) don't get hit in bursts
+type hostLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newHostLimiter(requestsPerMinute float64, burst int) *hostLimiter {
+	if requestsPerMinute <= 0 {
+		requestsPerMinute = defaultHostRequestsPerMinute
+	}
+	if burst < 1 {
+		burst = defaultHostBurst
+	}
+	return &hostLimiter{
+		rate:    requestsPerMinute / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Blocks until a request to rawURL's host is allowed or ctx is done.
+// A nil limiter never blocks.
+func (l *hostLimiter) wait(ctx context.Context, rawURL string) error {
+	if l == nil {
+		return nil
+	}
+	host, err := limiterHost(rawURL)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	b := l.refill(host, time.Now())
+	// reserve a token now, even if that puts the bucket in debt, so that
+	// concurrent callers queue up behind each other
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Takes a token for rawURL's host and returns 0 if one is free. Otherwise
+// it takes nothing and returns how long until one will be, so the caller
+// can get on with requests to other hosts. A nil limiter always allows.
+func (l *hostLimiter) tryTake(rawURL string) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+	host, err := limiterHost(rawURL)
+	if err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.refill(host, time.Now())
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, nil
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), nil
+}
+
+// Returns host's bucket topped up for the time since it was last used.
+// l.mu must be held.
+func (l *hostLimiter) refill(host string, now time.Time) *tokenBucket {
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[host] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	return b
+}
+
+func limiterHost(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(u.Hostname()), nil
+}
+
+// Returned when a host answers 429 or 503 and asks us to come back later
+type retryAfterError struct {
+	status  int
+	retryAt time.Time
+}
+
+func (e *retryAfterError) Error() string {
+	return "server returned " + http.StatusText(e.status) + ", retry after " + e.retryAt.Format(time.RFC1123)
+}
+
+// Parses a Retry-After header, which is either a number of seconds or an
+// HTTP date. ok is false when the header is missing or malformed.
+func parseRetryAfter(header string, now time.Time) (time.Time, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return time.Time{}, false
+	}
+	var retryAt time.Time
+	if seconds, err := strconv.Atoi(header); err == nil {
+		retryAt = now.Add(time.Duration(seconds) * time.Second)
+	} else if t, err := http.ParseTime(header); err == nil {
+		retryAt = t
+	} else {
+		return time.Time{}, false
+	}
+	if retryAt.Before(now) {
+		retryAt = now
+	}
+	if retryAt.After(now.Add(maxRetryAfter)) {
+		retryAt = now.Add(maxRetryAfter)
+	}
+	return retryAt, true
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tepidmilk/gator/internal/database"
+)
+
+// Records printed by listing commands with --output. Field names are part
+// of gator's interface for scripts, so only ever add to them.
+
+type userRecord struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	IsAdmin   bool      `json:"is_admin"`
+	Current   bool      `json:"current"`
+}
+
+type feedRecord struct {
+	ID            uuid.UUID  `json:"id"`
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	SiteLink      *string    `json:"site_link"`
+	Description   *string    `json:"description" table:"-"`
+	Language      *string    `json:"language"`
+	AddedBy       string     `json:"added_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastFetchedAt *time.Time `json:"last_fetched_at"`
+	NextFetchAt   *time.Time `json:"next_fetch_at"`
+}
+
+type followRecord struct {
+	FeedID     uuid.UUID `json:"feed_id"`
+	FeedName   string    `json:"feed_name"`
+	FeedURL    string    `json:"feed_url"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type postRecord struct {
+	ID          uuid.UUID  `json:"id"`
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+	FeedID      uuid.UUID  `json:"feed_id"`
+	FeedName    string     `json:"feed_name"`
+	PublishedAt *time.Time `json:"published_at"`
+	Authors     []string   `json:"authors"`
+	Categories  []string   `json:"categories"`
+	ReadAt      *time.Time `json:"read_at"`
+	StarredAt   *time.Time `json:"starred_at"`
+	Enclosures  []string   `json:"enclosures" table:"-"`
+	Summary     *string    `json:"summary" table:"-"`
+	// the extracted article or full body; only filled in with --full
+	Content *string `json:"content" table:"-"`
+	// pass to browse --cursor to continue after this post
+	Cursor string `json:"cursor" table:"-"`
+}
+
+type apiKeyRecord struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+func newUserRecord(user database.User, currentUserName string) userRecord {
+	return userRecord{
+		ID:        user.ID,
+		Name:      user.Name,
+		CreatedAt: user.CreatedAt,
+		IsAdmin:   user.IsAdmin,
+		Current:   user.Name == currentUserName,
+	}
+}
+
+func newFeedRecord(feed database.GetFeedsRow) feedRecord {
+	return feedRecord{
+		ID:            feed.ID,
+		Name:          feed.Name,
+		URL:           feed.Url,
+		SiteLink:      stringOrNil(feed.SiteLink.String, feed.SiteLink.Valid),
+		Description:   stringOrNil(feed.Description.String, feed.Description.Valid),
+		Language:      stringOrNil(feed.Language.String, feed.Language.Valid),
+		AddedBy:       feed.UserName,
+		CreatedAt:     feed.CreatedAt,
+		LastFetchedAt: timeOrNil(feed.LastFethcedAt.Time, feed.LastFethcedAt.Valid),
+		NextFetchAt:   timeOrNil(feed.NextFetchAt.Time, feed.NextFetchAt.Valid),
+	}
+}
+
+func newFollowRecord(follow database.GetFeedFollowsForUserRow) followRecord {
+	return followRecord{
+		FeedID:     follow.FeedID,
+		FeedName:   follow.FeedName,
+		FeedURL:    follow.FeedUrl,
+		FollowedAt: follow.CreatedAt,
+	}
+}
+
+func newPostRecord(s *state, post database.BrowsePostsNewestRow, full bool) (postRecord, error) {
+	record := postRecord{
+		ID:          post.ID,
+		Title:       post.Title,
+		URL:         post.Url,
+		FeedID:      post.FeedID,
+		FeedName:    post.FeedName,
+		PublishedAt: timeOrNil(post.PublishedAt.Time, post.PublishedAt.Valid),
+		Authors:     []string{},
+		Categories:  []string{},
+		ReadAt:      timeOrNil(post.ReadAt.Time, post.ReadAt.Valid),
+		StarredAt:   timeOrNil(post.StarredAt.Time, post.StarredAt.Valid),
+		Enclosures:  []string{},
+		Summary:     stringOrNil(post.Description.String, post.Description.Valid),
+		Cursor:      encodeCursor(post),
+	}
+	if full && post.ArticleContent.Valid {
+		record.Content = &post.ArticleContent.String
+	} else if full && post.Content.Valid {
+		record.Content = &post.Content.String
+	}
+
+	authors, err := s.db.GetAuthorsForPost(context.Background(), post.ID)
+	if err != nil {
+		return record, fmt.Errorf("error getting authors: %v", err)
+	}
+	record.Authors = append(record.Authors, authors...)
+	categories, err := s.db.GetCategoriesForPost(context.Background(), post.ID)
+	if err != nil {
+		return record, fmt.Errorf("error getting categories: %v", err)
+	}
+	record.Categories = append(record.Categories, categories...)
+	enclosures, err := s.db.GetEnclosuresForPost(context.Background(), post.ID)
+	if err != nil {
+		return record, fmt.Errorf("error getting enclosures: %v", err)
+	}
+	for _, enclosure := range enclosures {
+		record.Enclosures = append(record.Enclosures, enclosure.Url)
+	}
+	return record, nil
+}
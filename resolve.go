@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/tepidmilk/gator/internal/database"
+	"github.com/tepidmilk/gator/internal/htmltext"
+)
+
+// Length of the ID prefix shown to users in listings
+const shortIDLength = 8
+
+func shortID(id uuid.UUID) string {
+	return id.String()[:shortIDLength]
+}
+
+// Looks up a post given its URL or (a prefix of) its ID
+func resolvePost(s *state, ref string) (database.Post, error) {
+	if strings.TrimSpace(ref) == "" {
+		return database.Post{}, errors.New("no post given")
+	}
+	posts, err := s.db.FindPosts(context.Background(), findPostsParams(ref))
+	if err != nil {
+		return database.Post{}, fmt.Errorf("error finding post: %v", err)
+	}
+	// an exact URL match wins over ID prefixes that happen to match too
+	for _, post := range posts {
+		if post.Url == ref {
+			return post, nil
+		}
+	}
+
+	switch len(posts) {
+	case 0:
+		return database.Post{}, fmt.Errorf("no post matches '%s'", ref)
+	case 1:
+		return posts[0], nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "'%s' matches more than one post:", ref)
+	for _, post := range posts {
+		fmt.Fprintf(&b, "\n - %s %s", shortID(post.ID), htmltext.StripControl(post.Title))
+	}
+	return database.Post{}, fmt.Errorf("%s", b.String())
+}
+
+// Looks up a feed given its name, (a prefix of) its URL or (a prefix of) its ID
+func resolveFeed(s *state, ref string) (database.FindFeedsRow, error) {
+	if strings.TrimSpace(ref) == "" {
+		return database.FindFeedsRow{}, errors.New("no feed given")
+	}
+	feeds, err := s.db.FindFeeds(context.Background(), findFeedsParams(ref))
+	if err != nil {
+		return database.FindFeedsRow{}, fmt.Errorf("error finding feed: %v", err)
+	}
+	// exact URLs, then exact names, win over prefixes that happen to match too
+	for _, feed := range feeds {
+		if feed.Url == ref {
+			return feed, nil
+		}
+	}
+	var named []database.FindFeedsRow
+	for _, feed := range feeds {
+		if strings.EqualFold(feed.Name, ref) {
+			named = append(named, feed)
+		}
+	}
+	if len(named) == 1 {
+		return named[0], nil
+	} else if len(named) > 1 {
+		feeds = named
+	}
+
+	switch len(feeds) {
+	case 0:
+		return database.FindFeedsRow{}, fmt.Errorf("no feed matches '%s': Try 'addfeed <name> <URL>'", ref)
+	case 1:
+		return feeds[0], nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "'%s' matches more than one feed:", ref)
+	for _, feed := range feeds {
+		fmt.Fprintf(&b, "\n - %s %s {%s}", shortID(feed.ID), htmltext.StripControl(feed.Name), feed.Url)
+	}
+	return database.FindFeedsRow{}, fmt.Errorf("%s", b.String())
+}
+
+func findPostsParams(ref string) database.FindPostsParams {
+	return database.FindPostsParams{Prefix: likePrefix(ref), Ref: ref}
+}
+
+func findFeedsParams(ref string) database.FindFeedsParams {
+	return database.FindFeedsParams{Prefix: likePrefix(ref), Ref: ref}
+}
+
+// A LIKE pattern matching anything that starts with ref, taken literally
+func likePrefix(ref string) string {
+	return likeEscaper.Replace(ref) + "%"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/tepidmilk/gator/internal/database"
+	"github.com/tepidmilk/gator/internal/htmltext"
+)
+
+// How often agg runs a pruning pass between fetches
+const pruneInterval = time.Hour
+
+// Delete posts that fall outside the retention policy
+func handlerPrune(s *state, cmd command) error {
+	old, excess, err := prunePosts(s)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d posts (%d past their max age, %d over their feed's post limit)\n", old+excess, old, excess)
+	return nil
+}
+
+// Set a feed's retention policy, overriding the global defaults.
+// A value of 0 falls back to the global setting.
+func handlerFeedRetention(s *state, cmd command, user database.User) error {
+	maxAge, err := strconv.Atoi(cmd.args[1])
+	if err != nil || maxAge < 0 {
+		return cmd.usageErrorf("max age must be a number of days: %s", cmd.args[1])
+	}
+	maxPosts, err := strconv.Atoi(cmd.args[2])
+	if err != nil || maxPosts < 0 {
+		return cmd.usageErrorf("max posts must be a number: %s", cmd.args[2])
+	}
+
+	feed, err := managedFeed(s, user, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	err = s.db.SetFeedRetention(context.Background(), database.SetFeedRetentionParams{
+		RetentionMaxAgeDays: sql.NullInt32{Int32: int32(maxAge), Valid: maxAge > 0},
+		RetentionMaxPosts:   sql.NullInt32{Int32: int32(maxPosts), Valid: maxPosts > 0},
+		UpdatedAt:           time.Now().UTC(),
+		ID:                  feed.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("error updating feed: %v", err)
+	}
+
+	fmt.Printf("Retention for %s: %s, %s\n", htmltext.StripControl(feed.Name), retentionSetting(maxAge, "days"), retentionSetting(maxPosts, "posts"))
+	return nil
+}
+
+func retentionSetting(n int, unit string) string {
+	if n == 0 {
+		return "global " + unit
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
+
+// Deletes posts older than their feed's max age and posts beyond its max
+// count, keeping starred posts and, unless configured otherwise, posts some
+// follower hasn't read yet
+func prunePosts(s *state) (old, excess int64, err error) {
+	old, err = s.db.PruneOldPosts(context.Background(), database.PruneOldPostsParams{
+		DefaultMaxAgeDays: sql.NullInt32{Int32: int32(s.cfg.RetentionMaxAgeDays), Valid: s.cfg.RetentionMaxAgeDays > 0},
+		Now:               time.Now().UTC(),
+		PruneUnread:       s.cfg.RetentionPruneUnread,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("error pruning old posts: %v", err)
+	}
+
+	excess, err = s.db.PruneExcessPosts(context.Background(), database.PruneExcessPostsParams{
+		DefaultMaxPosts: sql.NullInt32{Int32: int32(s.cfg.RetentionMaxPosts), Valid: s.cfg.RetentionMaxPosts > 0},
+		PruneUnread:     s.cfg.RetentionPruneUnread,
+	})
+	if err != nil {
+		return old, 0, fmt.Errorf("error pruning excess posts: %v", err)
+	}
+	return old, excess, nil
+}
+
+// Runs a pruning pass from the agg loop, logging what was removed
+func autoPrune(s *state) {
+	old, excess, err := prunePosts(s)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if old+excess > 0 {
+		log.Printf("Pruned %d posts (%d past their max age, %d over their feed's post limit)", old+excess, old, excess)
+	}
+}
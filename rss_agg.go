@@ -1,14 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/xml"
+	"fmt"
 	"html"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
+// Fetches and parses a feed. Callers are responsible for rate limiting.
 func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
 	if err != nil {
@@ -19,18 +23,54 @@ func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
 
 	req.Header.Set("User-Agent", "gator")
 
+	start := time.Now()
 	res, err := c.Do(req)
 	if err != nil {
+		observeFetch(0, start)
 		return &RSSFeed{}, err
 	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+		if retryAt, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now().UTC()); ok {
+			observeFetch(res.StatusCode, start)
+			return &RSSFeed{}, &retryAfterError{status: res.StatusCode, retryAt: retryAt}
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		observeFetch(res.StatusCode, start)
+		return &RSSFeed{}, fmt.Errorf("unexpected status fetching feed: %s", res.Status)
+	}
 
 	data, err := io.ReadAll(res.Body)
+	feedFetchBytes.Add(float64(len(data)))
 	if err != nil {
+		observeFetch(0, start)
 		return &RSSFeed{}, err
 	}
+	observeFetch(res.StatusCode, start)
+
+	rss, err := parseFeed(data)
+	// WebSub hubs may also be advertised in HTTP Link headers
+	rss.Channel.AtomLinks = append(rss.Channel.AtomLinks, parseLinkHeader(res.Header.Values("Link"))...)
+	return rss, err
+}
+
+// Parses a raw RSS or Atom document, whether fetched or pushed to us by a hub
+func parseFeed(data []byte) (*RSSFeed, error) {
+	if isAtom(data) {
+		rss, err := parseAtom(data)
+		if err != nil {
+			feedParseFailures.Inc()
+		}
+		return rss, err
+	}
 
 	var rss RSSFeed
-	err = xml.Unmarshal(data, &rss)
+	err := xml.Unmarshal(data, &rss)
+	if err != nil {
+		feedParseFailures.Inc()
+	}
 
 	rss.Channel.Title = html.UnescapeString(rss.Channel.Title)
 	rss.Channel.Description = html.UnescapeString(rss.Channel.Description)
@@ -41,3 +81,88 @@ func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
 
 	return &rss, err
 }
+
+// Reports whether the document's root element is an Atom <feed>
+func isAtom(data []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local == "feed"
+		}
+	}
+}
+
+// Parses an Atom document into the same shape as an RSS feed
+func parseAtom(data []byte) (*RSSFeed, error) {
+	var atom AtomFeed
+	err := xml.Unmarshal(data, &atom)
+
+	var rss RSSFeed
+	rss.Channel.Title = html.UnescapeString(atom.Title)
+	rss.Channel.Description = html.UnescapeString(atom.Subtitle)
+	rss.Channel.Generator = atom.Generator
+	rss.Channel.AtomLinks = atom.Links
+	for _, link := range atom.Links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			rss.Channel.Link = link.Href
+			break
+		}
+	}
+	rss.Channel.Image.URL = atom.Logo
+	if rss.Channel.Image.URL == "" {
+		rss.Channel.Image.URL = atom.Icon
+	}
+	for _, entry := range atom.Entries {
+		item := RSSItem{
+			Title:       html.UnescapeString(entry.Title),
+			Link:        entry.alternateLink(),
+			Description: entry.Summary.String(),
+			PubDate:     entry.Published,
+			Content:     entry.Content.String(),
+		}
+		if item.PubDate == "" {
+			item.PubDate = entry.Updated
+		}
+		for _, author := range entry.Authors {
+			item.Authors = append(item.Authors, author.Name)
+		}
+		for _, category := range entry.Categories {
+			item.Categories = append(item.Categories, category.Term)
+		}
+		for _, link := range entry.Links {
+			if link.Rel == "enclosure" {
+				item.Enclosures = append(item.Enclosures, RSSEnclosure{URL: link.Href, Type: link.Type, Length: link.Length})
+			}
+		}
+		rss.Channel.Item = append(rss.Channel.Item, item)
+	}
+
+	return &rss, err
+}
+
+// Parses RFC 8288 Link headers such as `<https://hub.example/>; rel="hub"`
+func parseLinkHeader(values []string) []AtomLink {
+	var links []AtomLink
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			fields := strings.Split(part, ";")
+			href := strings.TrimSpace(fields[0])
+			if !strings.HasPrefix(href, "<") || !strings.HasSuffix(href, ">") {
+				continue
+			}
+			link := AtomLink{Href: strings.Trim(href, "<>")}
+			for _, param := range fields[1:] {
+				key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if ok && strings.EqualFold(key, "rel") {
+					link.Rel = strings.Trim(val, `"`)
+				}
+			}
+			links = append(links, link)
+		}
+	}
+	return links
+}
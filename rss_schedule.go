@@ -0,0 +1,117 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upper bound on how far a publisher's hints can push a feed's next fetch
+const maxPublisherInterval = 7 * 24 * time.Hour
+
+// Returns how long the publisher asks us to wait between fetches, taking the
+// larger of <ttl> and the syndication module's updatePeriod/updateFrequency.
+// Zero means the feed gave no usable hint.
+func (f *RSSFeed) updateInterval() time.Duration {
+	var interval time.Duration
+
+	ttl, err := strconv.Atoi(strings.TrimSpace(f.Channel.TTL))
+	if err == nil && ttl > 0 {
+		interval = time.Duration(ttl) * time.Minute
+	}
+
+	var period time.Duration
+	switch strings.ToLower(strings.TrimSpace(f.Channel.UpdatePeriod)) {
+	case "hourly":
+		period = time.Hour
+	case "daily":
+		period = 24 * time.Hour
+	case "weekly":
+		period = 7 * 24 * time.Hour
+	case "monthly":
+		period = 30 * 24 * time.Hour
+	case "yearly":
+		period = 365 * 24 * time.Hour
+	}
+	if period > 0 {
+		frequency, err := strconv.Atoi(strings.TrimSpace(f.Channel.UpdateFrequency))
+		if err != nil || frequency < 1 {
+			frequency = 1
+		}
+		if p := period / time.Duration(frequency); p > interval {
+			interval = p
+		}
+	}
+
+	return min(interval, maxPublisherInterval)
+}
+
+// Reports whether the feed asked readers not to fetch it during t.
+// skipHours and skipDays are expressed in GMT.
+func (f *RSSFeed) skips(t time.Time) bool {
+	t = t.UTC()
+	for _, h := range f.Channel.SkipHours {
+		hour, err := strconv.Atoi(strings.TrimSpace(h))
+		if err != nil {
+			continue
+		}
+		// some publishers use 24 for midnight
+		if hour%24 == t.Hour() {
+			return true
+		}
+	}
+	for _, d := range f.Channel.SkipDays {
+		if strings.EqualFold(strings.TrimSpace(d), t.Weekday().String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Computes when a feed fetched at `from` should next be fetched, waiting at
+// least minInterval and honoring the publisher's ttl, update period and skip
+// windows.
+func (f *RSSFeed) nextFetchTime(from time.Time, minInterval time.Duration) time.Time {
+	next := from.Add(max(minInterval, f.updateInterval()))
+
+	// step forward an hour at a time out of any skipped window, giving up
+	// after a week in case the feed skips every hour of every day
+	for i := 0; i < 7*24 && f.skips(next); i++ {
+		next = next.Truncate(time.Hour).Add(time.Hour)
+	}
+	return next
+}
+
+// Bounds on the polling interval learned from a feed's posting history
+const (
+	minPollInterval = 15 * time.Minute
+	maxPollInterval = 48 * time.Hour
+)
+
+// How many of a feed's most recent posts are used to estimate its cadence
+const cadenceSampleSize = 20
+
+// Learns how often a feed should be polled from the publish times of its most
+// recent posts (newest first). Feeds are checked about twice per typical gap
+// between posts, and feeds that have gone quiet for longer than that back off
+// in proportion to how long they've been dormant. Feeds without enough
+// history fall back to defaultInterval.
+func pollInterval(published []time.Time, now time.Time, defaultInterval time.Duration) time.Duration {
+	if len(published) < 2 {
+		return defaultInterval
+	}
+
+	gaps := make([]time.Duration, 0, len(published)-1)
+	for i := 1; i < len(published); i++ {
+		gaps = append(gaps, published[i-1].Sub(published[i]).Abs())
+	}
+	slices.Sort(gaps)
+	cadence := gaps[len(gaps)/2]
+
+	if dormant := now.Sub(published[0]); dormant > cadence {
+		cadence = dormant
+	}
+
+	return min(max(cadence/2, minPollInterval), maxPollInterval)
+}
@@ -1,17 +1,164 @@
 package main
 
+import "strings"
+
 type RSSFeed struct {
 	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Item        []RSSItem `xml:"item"`
+		// must come before Link so atom:link elements don't clobber it
+		AtomLinks   []AtomLink `xml:"http://www.w3.org/2005/Atom link"`
+		Title       string     `xml:"title"`
+		Link        string     `xml:"link"`
+		Description string     `xml:"description"`
+		Language    string     `xml:"language"`
+		Generator   string     `xml:"generator"`
+		Image       RSSImage   `xml:"image"`
+		TTL         string     `xml:"ttl"`
+		SkipHours   []string   `xml:"skipHours>hour"`
+		SkipDays    []string   `xml:"skipDays>day"`
+		// Syndication module hints (http://purl.org/rss/1.0/modules/syndication/)
+		UpdatePeriod    string    `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string    `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+		Item            []RSSItem `xml:"item"`
 	} `xml:"channel"`
 }
 
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// Returns the href of the first link with the given rel, if any
+func (f *RSSFeed) linkWithRel(rel string) string {
+	for _, link := range f.Channel.AtomLinks {
+		if strings.EqualFold(link.Rel, rel) && link.Href != "" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+type RSSImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
 type RSSItem struct {
 	Title       string `xml:"title"`
 	Link        string `xml:"link"`
 	Description string `xml:"description"`
 	PubDate     string `xml:"pubDate"`
+	// Full article body; WordPress and friends put it in content:encoded
+	Content    string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Enclosures []RSSEnclosure `xml:"enclosure"`
+	Authors    []string       `xml:"author"`
+	Creators   []string       `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories []string       `xml:"category"`
+	// Podcast episode details
+	ItunesDuration string     `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ItunesEpisode  string     `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	ItunesImage    ItunesHref `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+}
+
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type ItunesHref struct {
+	Href string `xml:"href,attr"`
+}
+
+// Returns the item's distinct author names from <author> and dc:creator.
+// RSS <author> is usually "email (Name)", in which case only Name is kept.
+func (item *RSSItem) authorNames() []string {
+	var names []string
+	for _, author := range append(item.Authors, item.Creators...) {
+		author = strings.TrimSpace(author)
+		if open := strings.Index(author, "("); open > 0 && strings.HasSuffix(author, ")") && strings.Contains(author[:open], "@") {
+			author = strings.TrimSpace(author[open+1 : len(author)-1])
+		}
+		names = appendDistinct(names, author)
+	}
+	return names
+}
+
+func (item *RSSItem) categoryNames() []string {
+	var names []string
+	for _, category := range item.Categories {
+		names = appendDistinct(names, strings.TrimSpace(category))
+	}
+	return names
+}
+
+// Appends name unless it's empty or already present, ignoring case
+func appendDistinct(names []string, name string) []string {
+	if name == "" {
+		return names
+	}
+	for _, existing := range names {
+		if strings.EqualFold(existing, name) {
+			return names
+		}
+	}
+	return append(names, name)
+}
+
+// Atom feeds are converted into an RSSFeed after parsing
+type AtomFeed struct {
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle"`
+	Links     []AtomLink  `xml:"link"`
+	Generator string      `xml:"generator"`
+	Icon      string      `xml:"icon"`
+	Logo      string      `xml:"logo"`
+	Entries   []AtomEntry `xml:"entry"`
+}
+
+type AtomEntry struct {
+	Title      string         `xml:"title"`
+	Links      []AtomLink     `xml:"link"`
+	Summary    AtomText       `xml:"summary"`
+	Content    AtomText       `xml:"content"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Authors    []AtomPerson   `xml:"author"`
+	Categories []AtomCategory `xml:"category"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+// Atom text constructs are either plain text, escaped HTML or inline XHTML
+type AtomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t AtomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// Returns the entry's rel="alternate" link (links without a rel are
+// alternate links too)
+func (e *AtomEntry) alternateLink() string {
+	for _, link := range e.Links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	return ""
 }
@@ -0,0 +1,29 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, created_at, user_id, name, key_hash)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetAPIKeyByHash :one
+SELECT * FROM api_keys
+WHERE key_hash = $1 AND revoked_at IS NULL;
+
+-- name: GetAPIKeysForUser :many
+SELECT * FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = $1
+WHERE id = $2;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = $1
+WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL;
\ No newline at end of file
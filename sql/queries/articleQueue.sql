@@ -0,0 +1,14 @@
+-- name: QueueArticle :exec
+INSERT INTO article_queue (post_id, queued_at)
+VALUES ($1, $2)
+ON CONFLICT (post_id) DO NOTHING;
+
+-- name: GetQueuedArticles :many
+SELECT posts.* FROM article_queue
+INNER JOIN posts ON posts.id = article_queue.post_id
+ORDER BY article_queue.queued_at
+LIMIT $1;
+
+-- name: DequeueArticle :exec
+DELETE FROM article_queue
+WHERE post_id = $1;
\ No newline at end of file
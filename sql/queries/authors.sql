@@ -0,0 +1,22 @@
+-- name: UpsertAuthor :one
+INSERT INTO authors (id, created_at, updated_at, name)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (name) DO UPDATE
+SET updated_at = EXCLUDED.updated_at
+RETURNING id;
+
+-- name: AddPostAuthor :exec
+INSERT INTO post_authors (post_id, author_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: GetAuthorsForPost :many
+SELECT authors.name FROM authors
+INNER JOIN post_authors ON post_authors.author_id = authors.id
+WHERE post_authors.post_id = $1
+ORDER BY authors.name;
\ No newline at end of file
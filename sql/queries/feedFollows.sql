@@ -18,7 +18,7 @@ INNER JOIN users ON inserted_feed_follow.user_id = users.id
 INNER JOIN feeds ON inserted_feed_follow.feed_id = feeds.id;
 
 -- name: GetFeedFollowsForUser :many
-SELECT users.name as user_name, feeds.name as feed_name, feed_follows.* FROM feed_follows
+SELECT users.name as user_name, feeds.name as feed_name, feeds.url as feed_url, feed_follows.* FROM feed_follows
 INNER JOIN users on users.id = feed_follows.user_id
 INNER JOIN feeds on feeds.id = feed_follows.feed_id
 WHERE users.name = $1;
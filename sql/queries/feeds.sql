@@ -11,9 +11,20 @@ VALUES (
 RETURNING *;
 
 -- name: GetFeeds :many
-SELECT feeds.name, feeds.url, users.name
+SELECT feeds.*, users.name as user_name
 FROM feeds INNER JOIN users
-ON feeds.user_id = users.id;
+ON feeds.user_id = users.id
+ORDER BY feeds.name;
+
+-- name: GetFeed :one
+SELECT * FROM feeds
+WHERE id = $1;
+
+-- name: GetFeedWithOwner :one
+SELECT feeds.*, users.name as user_name
+FROM feeds INNER JOIN users
+ON feeds.user_id = users.id
+WHERE feeds.id = $1;
 
 -- name: GetFeedByURL :one
 SELECT id FROM feeds
@@ -21,9 +32,81 @@ WHERE url = $1;
 
 -- name: MarkFeedFetched :exec
 UPDATE feeds
-SET last_fethced_at = $1, updated_at = $1
+SET last_fethced_at = $1, updated_at = $1, next_fetch_at = $2
+WHERE id = $3;
+
+-- name: SetFeedNextFetch :exec
+UPDATE feeds
+SET next_fetch_at = $1
 WHERE id = $2;
 
+-- name: SetFeedPollInterval :exec
+UPDATE feeds
+SET poll_interval_seconds = $1
+WHERE id = $2;
+
+-- name: GetNextFetchTime :one
+SELECT next_fetch_at FROM feeds
+WHERE next_fetch_at IS NOT NULL
+ORDER BY next_fetch_at ASC
+LIMIT 1;
+
+-- name: GetOldestDueTime :one
+-- feeds that were never fetched have been due since they were added
+SELECT COALESCE(next_fetch_at, created_at)::timestamp AS due_at FROM feeds
+WHERE next_fetch_at IS NULL OR next_fetch_at <= $1
+ORDER BY due_at ASC
+LIMIT 1;
+
 -- name: GetNextFeedToFetch :one
 SELECT * FROM feeds
-ORDER BY last_fethced_at ASC NULLS FIRST;
\ No newline at end of file
+WHERE next_fetch_at IS NULL OR next_fetch_at <= $1
+ORDER BY next_fetch_at ASC NULLS FIRST, last_fethced_at ASC NULLS FIRST
+LIMIT 1;
+
+-- name: UpdateFeedMetadata :exec
+UPDATE feeds
+SET site_link = $1,
+description = $2,
+language = $3,
+image_url = $4,
+generator = $5,
+updated_at = $6
+WHERE id = $7;
+
+-- name: FindFeeds :many
+SELECT feeds.*, users.name as user_name
+FROM feeds INNER JOIN users
+ON feeds.user_id = users.id
+WHERE feeds.url LIKE sqlc.arg(prefix)::text
+OR lower(feeds.name) = lower(sqlc.arg(ref)::text)
+OR feeds.id::text LIKE sqlc.arg(prefix)::text
+-- exact matches first so they're never cut by the limit
+ORDER BY feeds.url = sqlc.arg(ref)::text DESC,
+lower(feeds.name) = lower(sqlc.arg(ref)::text) DESC,
+feeds.name
+LIMIT 10;
+
+-- name: SetFeedFetchArticles :exec
+UPDATE feeds
+SET fetch_articles = $1, updated_at = $2
+WHERE id = $3;
+
+-- name: SetFeedRetention :exec
+UPDATE feeds
+SET retention_max_age_days = $1, retention_max_posts = $2, updated_at = $3
+WHERE id = $4;
+
+-- name: RenameFeed :exec
+UPDATE feeds
+SET name = $1, updated_at = $2
+WHERE id = $3;
+
+-- name: SetFeedURL :exec
+UPDATE feeds
+SET url = $1, updated_at = $2, next_fetch_at = NULL
+WHERE id = $3;
+
+-- name: DeleteFeed :exec
+DELETE FROM feeds
+WHERE id = $1;
\ No newline at end of file
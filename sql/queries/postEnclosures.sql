@@ -0,0 +1,17 @@
+-- name: CreatePostEnclosure :exec
+INSERT INTO post_enclosures (id, created_at, updated_at, post_id, url, mime_type, length)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+ON CONFLICT (post_id, url) DO NOTHING;
+
+-- name: GetEnclosuresForPost :many
+SELECT * FROM post_enclosures
+WHERE post_id = $1
+ORDER BY created_at ASC;
\ No newline at end of file
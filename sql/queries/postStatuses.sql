@@ -0,0 +1,30 @@
+-- name: MarkPostRead :exec
+INSERT INTO post_statuses (user_id, post_id, read_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read_at = EXCLUDED.read_at;
+
+-- name: MarkPostUnread :exec
+UPDATE post_statuses
+SET read_at = NULL
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: StarPost :exec
+INSERT INTO post_statuses (user_id, post_id, starred_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET starred_at = EXCLUDED.starred_at;
+
+-- name: UnstarPost :exec
+UPDATE post_statuses
+SET starred_at = NULL
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: GetUnreadCounts :many
+SELECT posts.feed_id, count(*) AS unread FROM posts
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_statuses ON post_statuses.post_id = posts.id
+AND post_statuses.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND post_statuses.read_at IS NULL
+GROUP BY posts.feed_id;
\ No newline at end of file
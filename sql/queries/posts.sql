@@ -1,5 +1,5 @@
 -- name: CreatePost :exec
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, content, itunes_duration, itunes_episode, itunes_image)
 VALUES (
     $1,
     $2,
@@ -8,14 +8,86 @@ VALUES (
     $5,
     $6,
     $7,
-    $8
+    $8,
+    $9,
+    $10,
+    $11,
+    $12
 )
 RETURNING *;
 
--- name: GetPostsForUser :many
-SELECT posts.*, feeds.name as feed_name FROM posts
+-- name: BrowsePostsNewest :many
+SELECT posts.*, feeds.name as feed_name, post_statuses.read_at, post_statuses.starred_at FROM posts
 INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
 INNER JOIN feeds ON posts.feed_id = feeds.id
-WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2;
\ No newline at end of file
+LEFT JOIN post_statuses ON post_statuses.post_id = posts.id
+AND post_statuses.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(author)::text IS NULL OR EXISTS (
+    SELECT 1 FROM post_authors
+    INNER JOIN authors ON authors.id = post_authors.author_id
+    WHERE post_authors.post_id = posts.id
+    AND lower(authors.name) = lower(sqlc.narg(author)::text)
+))
+AND (sqlc.narg(category)::text IS NULL OR EXISTS (
+    SELECT 1 FROM post_categories
+    INNER JOIN categories ON categories.id = post_categories.category_id
+    WHERE post_categories.post_id = posts.id
+    AND lower(categories.name) = lower(sqlc.narg(category)::text)
+))
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+AND (sqlc.narg(since)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) >= sqlc.narg(since)::timestamp)
+AND (sqlc.narg(until)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) < sqlc.narg(until)::timestamp)
+AND (sqlc.narg(cursor_time)::timestamp IS NULL
+    OR (COALESCE(posts.published_at, posts.created_at), posts.id) < (sqlc.narg(cursor_time)::timestamp, sqlc.arg(cursor_id)::uuid))
+ORDER BY COALESCE(posts.published_at, posts.created_at) DESC, posts.id DESC
+LIMIT sqlc.arg(max_posts);
+
+-- name: BrowsePostsOldest :many
+SELECT posts.*, feeds.name as feed_name, post_statuses.read_at, post_statuses.starred_at FROM posts
+INNER JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+INNER JOIN feeds ON posts.feed_id = feeds.id
+LEFT JOIN post_statuses ON post_statuses.post_id = posts.id
+AND post_statuses.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(author)::text IS NULL OR EXISTS (
+    SELECT 1 FROM post_authors
+    INNER JOIN authors ON authors.id = post_authors.author_id
+    WHERE post_authors.post_id = posts.id
+    AND lower(authors.name) = lower(sqlc.narg(author)::text)
+))
+AND (sqlc.narg(category)::text IS NULL OR EXISTS (
+    SELECT 1 FROM post_categories
+    INNER JOIN categories ON categories.id = post_categories.category_id
+    WHERE post_categories.post_id = posts.id
+    AND lower(categories.name) = lower(sqlc.narg(category)::text)
+))
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+AND (sqlc.narg(since)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) >= sqlc.narg(since)::timestamp)
+AND (sqlc.narg(until)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) < sqlc.narg(until)::timestamp)
+AND (sqlc.narg(cursor_time)::timestamp IS NULL
+    OR (COALESCE(posts.published_at, posts.created_at), posts.id) > (sqlc.narg(cursor_time)::timestamp, sqlc.arg(cursor_id)::uuid))
+ORDER BY COALESCE(posts.published_at, posts.created_at) ASC, posts.id ASC
+LIMIT sqlc.arg(max_posts);
+
+-- name: GetRecentPublishTimes :many
+SELECT published_at FROM posts
+WHERE feed_id = $1 AND published_at IS NOT NULL
+ORDER BY published_at DESC
+LIMIT $2;
+
+-- name: FindPosts :many
+SELECT * FROM posts
+WHERE id::text LIKE sqlc.arg(prefix)::text
+OR url = sqlc.arg(ref)::text
+ORDER BY url = sqlc.arg(ref)::text DESC
+LIMIT 10;
+
+-- name: SetPostArticle :exec
+UPDATE posts
+SET article_content = $1, article_fetched_at = $2, updated_at = $2
+WHERE id = $3;
+
+-- name: GetPost :one
+SELECT * FROM posts
+WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,46 @@
+-- name: PruneOldPosts :execrows
+DELETE FROM posts
+USING feeds
+WHERE posts.feed_id = feeds.id
+AND COALESCE(feeds.retention_max_age_days, sqlc.narg(default_max_age_days)::int) > 0
+AND COALESCE(posts.published_at, posts.created_at) < sqlc.arg(now)::timestamp - make_interval(days => COALESCE(feeds.retention_max_age_days, sqlc.narg(default_max_age_days)::int))
+AND NOT EXISTS (
+    SELECT 1 FROM post_statuses
+    WHERE post_statuses.post_id = posts.id
+    AND post_statuses.starred_at IS NOT NULL
+)
+AND (sqlc.arg(prune_unread)::boolean OR NOT EXISTS (
+    SELECT 1 FROM feed_follows
+    LEFT JOIN post_statuses ON post_statuses.post_id = posts.id
+    AND post_statuses.user_id = feed_follows.user_id
+    WHERE feed_follows.feed_id = posts.feed_id
+    AND post_statuses.read_at IS NULL
+));
+
+-- name: PruneExcessPosts :execrows
+DELETE FROM posts
+WHERE posts.id IN (
+    SELECT ranked.id FROM (
+        SELECT p.id, p.feed_id, row_number() OVER (
+            PARTITION BY p.feed_id
+            ORDER BY p.published_at DESC NULLS LAST, p.created_at DESC
+        ) AS position
+        FROM posts p
+        -- posts that are kept anyway don't count toward the limit
+        WHERE NOT EXISTS (
+            SELECT 1 FROM post_statuses
+            WHERE post_statuses.post_id = p.id
+            AND post_statuses.starred_at IS NOT NULL
+        )
+        AND (sqlc.arg(prune_unread)::boolean OR NOT EXISTS (
+            SELECT 1 FROM feed_follows
+            LEFT JOIN post_statuses ON post_statuses.post_id = p.id
+            AND post_statuses.user_id = feed_follows.user_id
+            WHERE feed_follows.feed_id = p.feed_id
+            AND post_statuses.read_at IS NULL
+        ))
+    ) AS ranked
+    INNER JOIN feeds ON feeds.id = ranked.feed_id
+    WHERE COALESCE(feeds.retention_max_posts, sqlc.narg(default_max_posts)::int) > 0
+    AND ranked.position > COALESCE(feeds.retention_max_posts, sqlc.narg(default_max_posts)::int)
+);
\ No newline at end of file
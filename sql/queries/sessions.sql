@@ -0,0 +1,27 @@
+-- name: CreateSession :exec
+INSERT INTO sessions (id, created_at, user_id, token_hash, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+);
+
+-- name: GetSessionUser :one
+SELECT users.* FROM sessions
+INNER JOIN users ON users.id = sessions.user_id
+WHERE sessions.token_hash = $1
+AND sessions.expires_at > $2;
+
+-- name: DeleteSession :exec
+DELETE FROM sessions
+WHERE token_hash = $1;
+
+-- name: DeleteSessionsForUser :exec
+DELETE FROM sessions
+WHERE user_id = $1;
+
+-- name: DeleteExpiredSessions :execrows
+DELETE FROM sessions
+WHERE expires_at <= $1;
\ No newline at end of file
@@ -1,10 +1,12 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name)
+-- the first user to register becomes an admin
+INSERT INTO users (id, created_at, updated_at, name, is_admin)
 VALUES (
     $1,
     $2,
     $3,
-    $4
+    $4,
+    NOT EXISTS (SELECT 1 FROM users)
 )
 RETURNING *;
 
@@ -16,4 +18,31 @@ WHERE name = $1;
 DELETE FROM users;
 
 -- name: GetUsers :many
-SELECT name FROM users;
\ No newline at end of file
+SELECT name FROM users;
+
+-- name: ListUsers :many
+SELECT * FROM users
+ORDER BY name;
+
+-- name: SetUserAdmin :exec
+UPDATE users
+SET is_admin = $1, updated_at = $2
+WHERE id = $3;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: SetUserPassword :exec
+UPDATE users
+SET password_hash = $1, updated_at = $2
+WHERE id = $3;
+
+-- name: SetUserFeedToken :exec
+UPDATE users
+SET feed_token_hash = $1, updated_at = $2
+WHERE id = $3;
+
+-- name: GetUserByFeedToken :one
+SELECT * FROM users
+WHERE feed_token_hash = $1;
\ No newline at end of file
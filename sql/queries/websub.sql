@@ -0,0 +1,57 @@
+-- name: UpsertWebSubSubscription :exec
+INSERT INTO websub_subscriptions (id, created_at, updated_at, feed_id, hub_url, topic_url, secret)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+ON CONFLICT (feed_id) DO UPDATE
+SET hub_url = EXCLUDED.hub_url,
+topic_url = EXCLUDED.topic_url,
+updated_at = EXCLUDED.updated_at,
+state = 'discovered'
+WHERE websub_subscriptions.hub_url <> EXCLUDED.hub_url
+OR websub_subscriptions.topic_url <> EXCLUDED.topic_url;
+
+-- name: GetWebSubSubscription :one
+SELECT * FROM websub_subscriptions
+WHERE id = $1;
+
+-- name: GetWebSubSubscriptionForFeed :one
+SELECT * FROM websub_subscriptions
+WHERE feed_id = $1;
+
+-- name: GetWebSubSubscriptionsToRenew :many
+SELECT * FROM websub_subscriptions
+-- denied requests are retried after a while, and renewals that went
+-- unanswered are re-sent as often as unverified requests
+WHERE state = 'discovered'
+OR (state = 'pending' AND requested_at < $1)
+OR (state = 'active' AND lease_expires_at < $2
+    AND (requested_at IS NULL OR requested_at < $1))
+OR (state = 'denied' AND updated_at < $3);
+
+-- name: MarkWebSubRequested :exec
+UPDATE websub_subscriptions
+SET requested_at = $1,
+updated_at = $1,
+state = CASE WHEN state = 'active' THEN state ELSE 'pending' END
+WHERE id = $2;
+
+-- name: ActivateWebSubSubscription :exec
+UPDATE websub_subscriptions
+SET state = 'active', lease_expires_at = $1, updated_at = $2
+WHERE id = $3;
+
+-- name: SetWebSubState :exec
+UPDATE websub_subscriptions
+SET state = $1, updated_at = $2
+WHERE id = $3;
+
+-- name: DeleteWebSubSubscriptionForFeed :exec
+DELETE FROM websub_subscriptions
+WHERE feed_id = $1;
\ No newline at end of file
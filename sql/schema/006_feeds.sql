@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD site_link TEXT,
+ADD description TEXT,
+ADD language TEXT,
+ADD image_url TEXT,
+ADD generator TEXT;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN site_link,
+DROP COLUMN description,
+DROP COLUMN language,
+DROP COLUMN image_url,
+DROP COLUMN generator;
\ No newline at end of file
@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE post_enclosures(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    post_id UUID NOT NULL,
+    url TEXT NOT NULL,
+    mime_type TEXT,
+    length BIGINT,
+    FOREIGN KEY (post_id)
+    REFERENCES posts(id) ON DELETE CASCADE,
+    CONSTRAINT post_enclosure UNIQUE (post_id, url)
+);
+
+ALTER TABLE posts
+ADD itunes_duration TEXT,
+ADD itunes_episode INTEGER,
+ADD itunes_image TEXT;
+
+-- +goose Down
+ALTER TABLE posts
+DROP COLUMN itunes_duration,
+DROP COLUMN itunes_episode,
+DROP COLUMN itunes_image;
+
+DROP TABLE post_enclosures;
\ No newline at end of file
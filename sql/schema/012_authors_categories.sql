@@ -0,0 +1,36 @@
+-- +goose Up
+CREATE TABLE authors(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE post_authors(
+    post_id UUID NOT NULL,
+    author_id UUID NOT NULL,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES authors(id) ON DELETE CASCADE,
+    PRIMARY KEY (post_id, author_id)
+);
+
+CREATE TABLE categories(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE post_categories(
+    post_id UUID NOT NULL,
+    category_id UUID NOT NULL,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE,
+    PRIMARY KEY (post_id, category_id)
+);
+
+-- +goose Down
+DROP TABLE post_categories;
+DROP TABLE categories;
+DROP TABLE post_authors;
+DROP TABLE authors;
\ No newline at end of file
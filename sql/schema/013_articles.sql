@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE posts
+ADD article_content TEXT,
+ADD article_fetched_at TIMESTAMP;
+
+ALTER TABLE feeds
+ADD fetch_articles BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN fetch_articles;
+
+ALTER TABLE posts
+DROP COLUMN article_content,
+DROP COLUMN article_fetched_at;
\ No newline at end of file
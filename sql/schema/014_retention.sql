@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE post_statuses(
+    user_id UUID NOT NULL,
+    post_id UUID NOT NULL,
+    read_at TIMESTAMP,
+    starred_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, post_id)
+);
+
+ALTER TABLE feeds
+ADD retention_max_age_days INTEGER,
+ADD retention_max_posts INTEGER;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN retention_max_age_days,
+DROP COLUMN retention_max_posts;
+
+DROP TABLE post_statuses;
\ No newline at end of file
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE users
+ADD is_admin BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE users SET is_admin = true
+WHERE id = (SELECT id FROM users ORDER BY created_at ASC LIMIT 1);
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN is_admin;
\ No newline at end of file
@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE users
+ADD password_hash TEXT;
+
+CREATE TABLE sessions(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    FOREIGN KEY (user_id)
+    REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE sessions;
+
+ALTER TABLE users
+DROP COLUMN password_hash;
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE article_queue(
+    post_id UUID PRIMARY KEY,
+    queued_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (post_id)
+    REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX article_queue_queued_at_idx ON article_queue (queued_at);
+
+-- +goose Down
+DROP TABLE article_queue;
\ No newline at end of file
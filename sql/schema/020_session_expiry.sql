@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE sessions
+ADD expires_at TIMESTAMP;
+
+UPDATE sessions
+SET expires_at = created_at + interval '90 days';
+
+ALTER TABLE sessions
+ALTER COLUMN expires_at SET NOT NULL;
+
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
+
+-- +goose Down
+ALTER TABLE sessions
+DROP COLUMN expires_at;
\ No newline at end of file
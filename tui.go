@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/google/uuid"
+	"github.com/tepidmilk/gator/internal/database"
+	"github.com/tepidmilk/gator/internal/htmltext"
+)
+
+// Posts loaded into the post list at a time; more are loaded on reaching
+// the end of the list
+const tuiPageSize = 100
+
+// How often the reader reloads feeds and posts to pick up new ones
+const tuiRefreshInterval = 30 * time.Second
+
+const (
+	paneFeeds = iota
+	panePosts
+	paneContent
+)
+
+var (
+	tuiPaneStyle     = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8"))
+	tuiFocusedStyle  = tuiPaneStyle.BorderForeground(lipgloss.Color("12"))
+	tuiSelectedStyle = lipgloss.NewStyle().Reverse(true)
+	tuiDimmedStyle   = lipgloss.NewStyle().Underline(true)
+	tuiTitleStyle    = lipgloss.NewStyle().Bold(true)
+	tuiStatusStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+)
+
+// Read followed feeds in a three-pane terminal interface
+func handlerTUI(s *state, cmd command, user database.User) error {
+	_, err := tea.NewProgram(tuiModel{s: s, user: user}, tea.WithAltScreen()).Run()
+	return err
+}
+
+type tuiModel struct {
+	s    *state
+	user database.User
+
+	feeds  []database.GetFeedFollowsForUserRow
+	unread map[uuid.UUID]int64
+	// 0 is "All feeds", feeds[i] is at i+1
+	feedIdx int
+
+	posts       []database.BrowsePostsNewestRow
+	postIdx     int
+	morePosts   bool
+	loadingMore bool
+
+	// the selected post's header and rendered body
+	content       []string
+	contentScroll int
+
+	focus         int
+	width, height int
+	status        string
+}
+
+type tuiFeedsMsg struct {
+	feeds  []database.GetFeedFollowsForUserRow
+	unread map[uuid.UUID]int64
+}
+
+type tuiPostsMsg struct {
+	feedID   uuid.NullUUID
+	posts    []database.BrowsePostsNewestRow
+	limit    int
+	appended bool
+}
+
+// A post's read or starred state changed, so unread counts need reloading
+type tuiChangedMsg string
+
+type tuiErrMsg struct{ err error }
+
+type tuiTickMsg time.Time
+
+func (m tuiModel) Init() tea.Cmd {
+	return tea.Batch(m.loadFeeds(), m.loadPosts(uuid.NullUUID{}, nil, tuiPageSize), tuiTick())
+}
+
+func tuiTick() tea.Cmd {
+	return tea.Tick(tuiRefreshInterval, func(t time.Time) tea.Msg {
+		return tuiTickMsg(t)
+	})
+}
+
+func (m tuiModel) loadFeeds() tea.Cmd {
+	s, user := m.s, m.user
+	return func() tea.Msg {
+		feeds, err := s.db.GetFeedFollowsForUser(context.Background(), user.Name)
+		if err != nil {
+			return tuiErrMsg{fmt.Errorf("error getting followed feeds: %v", err)}
+		}
+		counts, err := s.db.GetUnreadCounts(context.Background(), user.ID)
+		if err != nil {
+			return tuiErrMsg{fmt.Errorf("error counting unread posts: %v", err)}
+		}
+		unread := make(map[uuid.UUID]int64, len(counts))
+		for _, count := range counts {
+			unread[count.FeedID] = count.Unread
+		}
+		return tuiFeedsMsg{feeds: feeds, unread: unread}
+	}
+}
+
+// Loads posts from a feed, or from all feeds when feedID isn't valid,
+// continuing after the given post if there is one
+func (m tuiModel) loadPosts(feedID uuid.NullUUID, after *database.BrowsePostsNewestRow, limit int) tea.Cmd {
+	s, userID := m.s, m.user.ID
+	return func() tea.Msg {
+		params := database.BrowsePostsNewestParams{
+			UserID:   userID,
+			FeedID:   feedID,
+			MaxPosts: int32(limit),
+		}
+		if after != nil {
+			params.CursorTime = sql.NullTime{Time: sortTime(*after), Valid: true}
+			params.CursorID = after.ID
+		}
+		posts, err := browsePosts(s, params, sortNewest)
+		if err != nil {
+			return tuiErrMsg{fmt.Errorf("error getting posts: %v", err)}
+		}
+		return tuiPostsMsg{feedID: feedID, posts: posts, limit: limit, appended: after != nil}
+	}
+}
+
+// Reloads everything, keeping as many posts loaded as there are now
+func (m tuiModel) refresh() tea.Cmd {
+	return tea.Batch(m.loadFeeds(), m.loadPosts(m.selectedFeed(), nil, max(len(m.posts), tuiPageSize)))
+}
+
+func (m tuiModel) selectedFeed() uuid.NullUUID {
+	if m.feedIdx == 0 || m.feedIdx > len(m.feeds) {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: m.feeds[m.feedIdx-1].FeedID, Valid: true}
+}
+
+func (m tuiModel) selectedPost() (database.BrowsePostsNewestRow, bool) {
+	if m.postIdx >= len(m.posts) {
+		return database.BrowsePostsNewestRow{}, false
+	}
+	return m.posts[m.postIdx], true
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.renderContent()
+	case tuiFeedsMsg:
+		m.feeds, m.unread = msg.feeds, msg.unread
+		m.feedIdx = min(m.feedIdx, len(m.feeds))
+	case tuiPostsMsg:
+		// ignore posts for a feed that's no longer selected
+		if msg.feedID != m.selectedFeed() {
+			return m, nil
+		}
+		m.morePosts = len(msg.posts) == msg.limit
+		if msg.appended {
+			m.loadingMore = false
+			m.posts = append(m.posts, msg.posts...)
+			return m, nil
+		}
+		// keep the same post selected, and scrolled, across refreshes
+		selected, ok := m.selectedPost()
+		scroll := m.contentScroll
+		m.posts, m.postIdx = msg.posts, 0
+		for i, post := range m.posts {
+			if ok && post.ID == selected.ID {
+				m.postIdx = i
+			}
+		}
+		m.renderContent()
+		if current, found := m.selectedPost(); ok && found && current.ID == selected.ID {
+			m.contentScroll = scroll
+		}
+	case tuiChangedMsg:
+		m.status = string(msg)
+		return m, m.loadFeeds()
+	case tuiErrMsg:
+		m.status = "error: " + msg.err.Error()
+		m.loadingMore = false
+	case tuiTickMsg:
+		return m, tea.Batch(m.refresh(), tuiTick())
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	}
+	return m, nil
+}
+
+func (m tuiModel) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.status = ""
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "tab":
+		m.focus = (m.focus + 1) % 3
+	case "shift+tab":
+		m.focus = (m.focus + 2) % 3
+	case "right", "l":
+		m.focus = min(m.focus+1, paneContent)
+	case "left", "h", "esc":
+		m.focus = max(m.focus-1, paneFeeds)
+	case "down", "j":
+		return m.move(1)
+	case "up", "k":
+		return m.move(-1)
+	case "pgdown", " ":
+		return m.move(m.paneHeight())
+	case "pgup":
+		return m.move(-m.paneHeight())
+	case "home", "g":
+		return m.move(-1 << 30)
+	case "end", "G":
+		return m.move(1 << 30)
+	case "enter":
+		switch m.focus {
+		case paneFeeds:
+			m.focus = panePosts
+		case panePosts:
+			m.focus = paneContent
+			if post, ok := m.selectedPost(); ok && !post.ReadAt.Valid {
+				return m, m.setRead(true)
+			}
+		}
+	case "r":
+		if post, ok := m.selectedPost(); ok {
+			return m, m.setRead(!post.ReadAt.Valid)
+		}
+	case "s":
+		if post, ok := m.selectedPost(); ok {
+			return m, m.setStarred(!post.StarredAt.Valid)
+		}
+	case "o":
+		return m, m.openLink()
+	case "R":
+		m.status = "Refreshing..."
+		return m, m.refresh()
+	}
+	return m, nil
+}
+
+// Moves the selection, or scrolls the content, in the focused pane
+func (m tuiModel) move(delta int) (tea.Model, tea.Cmd) {
+	switch m.focus {
+	case paneFeeds:
+		feedIdx := min(max(m.feedIdx+delta, 0), len(m.feeds))
+		if feedIdx == m.feedIdx {
+			return m, nil
+		}
+		m.feedIdx = feedIdx
+		m.posts, m.postIdx, m.morePosts, m.loadingMore = nil, 0, false, false
+		m.renderContent()
+		return m, m.loadPosts(m.selectedFeed(), nil, tuiPageSize)
+	case panePosts:
+		postIdx := min(max(m.postIdx+delta, 0), max(len(m.posts)-1, 0))
+		if postIdx != m.postIdx {
+			m.postIdx = postIdx
+			m.renderContent()
+		}
+		if m.postIdx == len(m.posts)-1 && m.morePosts && !m.loadingMore {
+			m.loadingMore = true
+			last := m.posts[len(m.posts)-1]
+			return m, m.loadPosts(m.selectedFeed(), &last, tuiPageSize)
+		}
+	case paneContent:
+		m.contentScroll = min(max(m.contentScroll+delta, 0), max(len(m.content)-m.paneHeight(), 0))
+	}
+	return m, nil
+}
+
+func (m *tuiModel) setRead(read bool) tea.Cmd {
+	post := &m.posts[m.postIdx]
+	post.ReadAt = sql.NullTime{Time: time.Now().UTC(), Valid: read}
+	s, userID, postID, title := m.s, m.user.ID, post.ID, post.Title
+	return func() tea.Msg {
+		var err error
+		if read {
+			err = s.db.MarkPostRead(context.Background(), database.MarkPostReadParams{
+				UserID: userID,
+				PostID: postID,
+				ReadAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+			})
+		} else {
+			err = s.db.MarkPostUnread(context.Background(), database.MarkPostUnreadParams{
+				UserID: userID,
+				PostID: postID,
+			})
+		}
+		if err != nil {
+			return tuiErrMsg{fmt.Errorf("error updating post: %v", err)}
+		}
+		if read {
+			return tuiChangedMsg(fmt.Sprintf("Marked '%s' read", title))
+		}
+		return tuiChangedMsg(fmt.Sprintf("Marked '%s' unread", title))
+	}
+}
+
+func (m *tuiModel) setStarred(starred bool) tea.Cmd {
+	post := &m.posts[m.postIdx]
+	post.StarredAt = sql.NullTime{Time: time.Now().UTC(), Valid: starred}
+	s, userID, postID, title := m.s, m.user.ID, post.ID, post.Title
+	return func() tea.Msg {
+		var err error
+		if starred {
+			err = s.db.StarPost(context.Background(), database.StarPostParams{
+				UserID:    userID,
+				PostID:    postID,
+				StarredAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+			})
+		} else {
+			err = s.db.UnstarPost(context.Background(), database.UnstarPostParams{
+				UserID: userID,
+				PostID: postID,
+			})
+		}
+		if err != nil {
+			return tuiErrMsg{fmt.Errorf("error updating post: %v", err)}
+		}
+		if starred {
+			return tuiChangedMsg(fmt.Sprintf("Starred '%s'", title))
+		}
+		return tuiChangedMsg(fmt.Sprintf("Unstarred '%s'", title))
+	}
+}
+
+// Opens the selected post's link with $BROWSER, handing it the terminal
+// in case it's a text mode browser
+func (m tuiModel) openLink() tea.Cmd {
+	post, ok := m.selectedPost()
+	if !ok {
+		return nil
+	}
+	browser := strings.Fields(os.Getenv("BROWSER"))
+	if len(browser) == 0 {
+		return func() tea.Msg {
+			return tuiErrMsg{fmt.Errorf("set $BROWSER to open links")}
+		}
+	}
+	c := exec.Command(browser[0], append(browser[1:], post.Url)...)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		if err != nil {
+			return tuiErrMsg{fmt.Errorf("error opening link: %v", err)}
+		}
+		return nil
+	})
+}
+
+// Pane widths, including their borders
+func (m tuiModel) paneWidths() (feeds, posts, content int) {
+	feeds = max(m.width/5, 16)
+	posts = max(m.width*2/5, 20)
+	return feeds, posts, max(m.width-feeds-posts, 20)
+}
+
+// Lines of text that fit inside a pane
+func (m tuiModel) paneHeight() int {
+	// leave room for the borders and the status line
+	return max(m.height-3, 1)
+}
+
+// Renders the selected post for the content pane
+func (m *tuiModel) renderContent() {
+	m.content, m.contentScroll = nil, 0
+	post, ok := m.selectedPost()
+	if !ok || m.width == 0 {
+		return
+	}
+	_, _, width := m.paneWidths()
+	width -= 2
+
+	body := post.Description.String
+	if post.ArticleContent.Valid {
+		body = post.ArticleContent.String
+	} else if post.Content.Valid {
+		body = post.Content.String
+	}
+	header := fmt.Sprintf("%s · %s", htmltext.StripControl(post.FeedName), post.PublishedAt.Time.Format("Mon Jan 2 2006 15:04"))
+	m.content = append(m.content, strings.Split(ansi.Wordwrap(tuiTitleStyle.Render(htmltext.StripControl(post.Title)), width, ""), "\n")...)
+	m.content = append(m.content, header, post.Url, "")
+	m.content = append(m.content, strings.Split(htmltext.Render(body, width), "\n")...)
+}
+
+func (m tuiModel) View() string {
+	if m.width == 0 {
+		return "Loading..."
+	}
+	feedsWidth, postsWidth, contentWidth := m.paneWidths()
+	height := m.paneHeight()
+
+	feedItems := []string{fmt.Sprintf("All feeds (%d)", m.totalUnread())}
+	for _, feed := range m.feeds {
+		feedItems = append(feedItems, fmt.Sprintf("%s (%d)", htmltext.StripControl(feed.FeedName), m.unread[feed.FeedID]))
+	}
+
+	postItems := make([]string, 0, len(m.posts))
+	for _, post := range m.posts {
+		marks := " "
+		if post.StarredAt.Valid {
+			marks = "*"
+		}
+		if !post.ReadAt.Valid {
+			marks += "•"
+		} else {
+			marks += " "
+		}
+		postItems = append(postItems, fmt.Sprintf("%s %s %s", marks, sortTime(post).Format("Jan 02"), htmltext.StripControl(post.Title)))
+	}
+	if len(m.posts) == 0 {
+		postItems = append(postItems, "No posts")
+	}
+
+	var content []string
+	for _, line := range m.content[m.contentScroll:min(m.contentScroll+height, len(m.content))] {
+		content = append(content, ansi.Truncate(line, contentWidth-2, "…"))
+	}
+
+	panes := lipgloss.JoinHorizontal(lipgloss.Top,
+		m.pane(paneFeeds, feedsWidth, renderList(feedItems, m.feedIdx, feedsWidth-2, height, m.focus == paneFeeds)),
+		m.pane(panePosts, postsWidth, renderList(postItems, m.postIdx, postsWidth-2, height, m.focus == panePosts)),
+		m.pane(paneContent, contentWidth, strings.Join(content, "\n")),
+	)
+
+	status := m.status
+	if status == "" {
+		status = "tab: switch pane  j/k: move  enter: open  r: read  s: star  o: open link  R: refresh  q: quit"
+	}
+	return panes + "\n" + tuiStatusStyle.Render(ansi.Truncate(status, m.width, "…"))
+}
+
+func (m tuiModel) pane(pane, width int, body string) string {
+	style := tuiPaneStyle
+	if m.focus == pane {
+		style = tuiFocusedStyle
+	}
+	return style.Width(width - 2).Height(m.paneHeight()).MaxHeight(m.paneHeight() + 2).Render(body)
+}
+
+func (m tuiModel) totalUnread() int64 {
+	var total int64
+	for _, feed := range m.feeds {
+		total += m.unread[feed.FeedID]
+	}
+	return total
+}
+
+// Renders the visible part of a list, scrolled to keep the selected item
+// in view
+func renderList(items []string, selected, width, height int, focused bool) string {
+	start := max(selected-height+1, 0)
+	lines := make([]string, 0, height)
+	for i := start; i < len(items) && i < start+height; i++ {
+		line := ansi.Truncate(items[i], width, "…")
+		if i == selected && focused {
+			line = tuiSelectedStyle.Width(width).Render(line)
+		} else if i == selected {
+			line = tuiDimmedStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tepidmilk/gator/internal/database"
+	"github.com/tepidmilk/gator/internal/htmltext"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+// Cookie holding a web session's token
+const sessionCookie = "gator_session"
+
+// Post bodies are sanitized when stored and again when shown, and no
+// scripts are allowed to run at all
+const webContentSecurityPolicy = "default-src 'none'; img-src * data:; media-src *; style-src 'self' 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'"
+
+// Serves a minimal HTML reader over the same queries as the CLI. Browsers
+// log in with a password and get a session like `gator login` does.
+type webServer struct {
+	s      *state
+	pages  map[string]*template.Template
+	logins *loginThrottle
+}
+
+func newWebServer(s *state) (*webServer, error) {
+	web := &webServer{
+		s:      s,
+		pages:  make(map[string]*template.Template),
+		logins: &loginThrottle{failures: make(map[string]loginFailures)},
+	}
+	funcs := template.FuncMap{
+		"date":     func(t time.Time) string { return t.Format("Mon Jan 2 2006") },
+		"sortTime": sortTime,
+	}
+	for _, page := range []string{"login", "feeds", "posts", "post", "error"} {
+		tmpl, err := template.New("layout.html").Funcs(funcs).ParseFS(templateFiles, "templates/layout.html", "templates/"+page+".html")
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s template: %v", page, err)
+		}
+		web.pages[page] = tmpl
+	}
+	return web, nil
+}
+
+func (web *webServer) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /{$}", web.handleIndex)
+	mux.HandleFunc("GET /login", web.handleLoginForm)
+	mux.HandleFunc("POST /login", web.handleLogin)
+	mux.HandleFunc("POST /logout", web.handleLogout)
+	mux.HandleFunc("GET /feeds", web.loggedIn(web.handleFeeds))
+	mux.HandleFunc("POST /feeds/{id}/follow", web.loggedIn(web.handleFollow))
+	mux.HandleFunc("POST /feeds/{id}/unfollow", web.loggedIn(web.handleUnfollow))
+	mux.HandleFunc("GET /posts", web.loggedIn(web.handlePosts))
+	mux.HandleFunc("GET /posts/{id}", web.loggedIn(web.handlePost))
+	mux.HandleFunc("POST /posts/{id}/read", web.loggedIn(web.handleMarkRead))
+	mux.HandleFunc("POST /posts/{id}/unread", web.loggedIn(web.handleMarkUnread))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		web.renderError(w, r, http.StatusNotFound, "Page not found")
+	})
+}
+
+func (web *webServer) render(w http.ResponseWriter, status int, page string, data map[string]any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", webContentSecurityPolicy)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := web.pages[page].Execute(w, data)
+	if err != nil {
+		log.Printf("error rendering %s page: %v", page, err)
+	}
+}
+
+func (web *webServer) renderError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	user, _ := web.sessionUser(r)
+	web.render(w, status, "error", map[string]any{"User": user, "Message": message})
+}
+
+// Logs an unexpected error and shows a generic error page
+func (web *webServer) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println("error handling request:", err)
+	web.renderError(w, r, http.StatusInternalServerError, "Something went wrong")
+}
+
+// Returns the user whose session cookie the request carries
+func (web *webServer) sessionUser(r *http.Request) (database.User, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return database.User{}, err
+	}
+	return web.s.db.GetSessionUser(r.Context(), database.GetSessionUserParams{
+		TokenHash: hashToken(cookie.Value),
+		ExpiresAt: time.Now().UTC(),
+	})
+}
+
+type webHandler func(w http.ResponseWriter, r *http.Request, user database.User)
+
+// Sends visitors without a session to the login page, and refuses form
+// posts from other sites
+func (web *webServer) loggedIn(handler webHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && !sameOrigin(r) {
+			web.renderError(w, r, http.StatusForbidden, "Cross-site request refused")
+			return
+		}
+		user, err := web.sessionUser(r)
+		if err == http.ErrNoCookie || err == sql.ErrNoRows {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		} else if err != nil {
+			web.internalError(w, r, fmt.Errorf("error getting session: %v", err))
+			return
+		}
+		handler(w, r, user)
+	}
+}
+
+// Reports whether a request came from one of our own pages. Browsers send
+// Origin with form posts; requests without it aren't from a browser.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// Only follow redirects to our own pages
+func localRedirect(next, fallback string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return fallback
+	}
+	return next
+}
+
+func (web *webServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	_, err := web.sessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/posts", http.StatusSeeOther)
+}
+
+func (web *webServer) handleLoginForm(w http.ResponseWriter, r *http.Request) {
+	web.render(w, http.StatusOK, "login", map[string]any{})
+}
+
+// Logs in with a name and password. Unlike the CLI, the web reader only
+// lets in users who have set a password.
+func (web *webServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		web.renderError(w, r, http.StatusForbidden, "Cross-site request refused")
+		return
+	}
+	name := r.PostFormValue("name")
+	password := r.PostFormValue("password")
+	failed := func(message string) {
+		web.render(w, http.StatusUnauthorized, "login", map[string]any{"Name": name, "Error": message})
+	}
+	// throttle guesses at one user's password, and one client guessing at
+	// many users'
+	keys := []string{"name:" + strings.ToLower(name), "addr:" + clientAddr(r)}
+	if wait := web.logins.wait(keys...); wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		web.render(w, http.StatusTooManyRequests, "login", map[string]any{
+			"Name":  name,
+			"Error": fmt.Sprintf("Too many failed logins. Try again in %d seconds.", seconds),
+		})
+		return
+	}
+
+	user, err := web.s.db.GetUser(r.Context(), name)
+	if err == sql.ErrNoRows {
+		web.logins.fail(keys...)
+		failed("Wrong name or password")
+		return
+	} else if err != nil {
+		web.internalError(w, r, fmt.Errorf("error getting user: %v", err))
+		return
+	}
+	// users without a password can't log in here, but telling them so
+	// would tell anyone which accounts have none
+	if !user.PasswordHash.Valid {
+		web.logins.fail(keys...)
+		failed("Wrong name or password")
+		return
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash.String), []byte(password))
+	if err != nil {
+		web.logins.fail(keys...)
+		failed("Wrong name or password")
+		return
+	}
+	web.logins.reset(keys...)
+
+	token, err := createSession(r.Context(), web.s, user, webSessionLifetime)
+	if err != nil {
+		web.internalError(w, r, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(webSessionLifetime / time.Second),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(web.s.cfg.PublicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/posts", http.StatusSeeOther)
+}
+
+func (web *webServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		web.renderError(w, r, http.StatusForbidden, "Cross-site request refused")
+		return
+	}
+	cookie, err := r.Cookie(sessionCookie)
+	if err == nil {
+		err = web.s.db.DeleteSession(r.Context(), hashToken(cookie.Value))
+		if err != nil {
+			log.Println("error ending session:", err)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+type webFeed struct {
+	ID        uuid.UUID
+	Name      string
+	URL       string
+	Unread    int64
+	Following bool
+}
+
+// Lists the feeds the user follows and every other feed they could
+func (web *webServer) handleFeeds(w http.ResponseWriter, r *http.Request, user database.User) {
+	feeds, err := web.s.db.GetFeeds(r.Context())
+	if err != nil {
+		web.internalError(w, r, fmt.Errorf("error getting feeds: %v", err))
+		return
+	}
+	follows, err := web.s.db.GetFeedFollowsForUser(r.Context(), user.Name)
+	if err != nil {
+		web.internalError(w, r, fmt.Errorf("error getting followed feeds: %v", err))
+		return
+	}
+	counts, err := web.s.db.GetUnreadCounts(r.Context(), user.ID)
+	if err != nil {
+		web.internalError(w, r, fmt.Errorf("error getting unread counts: %v", err))
+		return
+	}
+	following := make(map[uuid.UUID]bool, len(follows))
+	for _, follow := range follows {
+		following[follow.FeedID] = true
+	}
+	unread := make(map[uuid.UUID]int64, len(counts))
+	for _, count := range counts {
+		unread[count.FeedID] = count.Unread
+	}
+
+	var followed, others []webFeed
+	for _, feed := range feeds {
+		item := webFeed{ID: feed.ID, Name: feed.Name, URL: feed.Url, Unread: unread[feed.ID], Following: following[feed.ID]}
+		if item.Following {
+			followed = append(followed, item)
+		} else {
+			others = append(others, item)
+		}
+	}
+	web.render(w, http.StatusOK, "feeds", map[string]any{"User": user, "Followed": followed, "Others": others})
+}
+
+func (web *webServer) handleFollow(w http.ResponseWriter, r *http.Request, user database.User) {
+	feed, ok := web.feedFromPath(w, r)
+	if !ok {
+		return
+	}
+	_, err := web.s.db.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	// following twice, e.g. from a double submit, is fine
+	if err != nil && !isUniqueViolation(err) {
+		web.internalError(w, r, fmt.Errorf("error creating feed follow record: %v", err))
+		return
+	}
+	http.Redirect(w, r, "/feeds", http.StatusSeeOther)
+}
+
+func (web *webServer) handleUnfollow(w http.ResponseWriter, r *http.Request, user database.User) {
+	feed, ok := web.feedFromPath(w, r)
+	if !ok {
+		return
+	}
+	err := web.s.db.DeleteFeedFollows(r.Context(), database.DeleteFeedFollowsParams{
+		UserID: user.ID,
+		FeedID: feed.ID,
+	})
+	if err != nil {
+		web.internalError(w, r, fmt.Errorf("error deleting feed follow: %v", err))
+		return
+	}
+	http.Redirect(w, r, "/feeds", http.StatusSeeOther)
+}
+
+// Shows a page of posts from followed feeds, optionally from just one
+func (web *webServer) handlePosts(w http.ResponseWriter, r *http.Request, user database.User) {
+	params := database.BrowsePostsNewestParams{
+		UserID:   user.ID,
+		MaxPosts: 25,
+	}
+	// read/unread buttons come back to this page
+	data := map[string]any{"User": user, "Path": r.URL.RequestURI()}
+	query := r.URL.Query()
+	if ref := query.Get("feed"); ref != "" {
+		id, err := uuid.Parse(ref)
+		if err != nil {
+			web.renderError(w, r, http.StatusNotFound, "Feed not found")
+			return
+		}
+		feed, err := web.s.db.GetFeed(r.Context(), id)
+		if err == sql.ErrNoRows {
+			web.renderError(w, r, http.StatusNotFound, "Feed not found")
+			return
+		} else if err != nil {
+			web.internalError(w, r, fmt.Errorf("error getting feed: %v", err))
+			return
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+		data["Feed"] = feed
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		t, id, err := decodeCursor(cursor)
+		if err != nil {
+			web.renderError(w, r, http.StatusBadRequest, "That page link is broken")
+			return
+		}
+		params.CursorTime = sql.NullTime{Time: t, Valid: true}
+		params.CursorID = id
+	}
+
+	posts, err := web.s.db.BrowsePostsNewest(r.Context(), params)
+	if err != nil {
+		web.internalError(w, r, fmt.Errorf("error getting posts for user: %v", err))
+		return
+	}
+	data["Posts"] = posts
+	if len(posts) == int(params.MaxPosts) {
+		next := url.Values{"cursor": {encodeCursor(posts[len(posts)-1])}}
+		if params.FeedID.Valid {
+			next.Set("feed", params.FeedID.UUID.String())
+		}
+		data["Next"] = "/posts?" + next.Encode()
+	}
+	web.render(w, http.StatusOK, "posts", data)
+}
+
+// Shows a post and marks it read
+func (web *webServer) handlePost(w http.ResponseWriter, r *http.Request, user database.User) {
+	post, ok := web.postFromPath(w, r)
+	if !ok {
+		return
+	}
+	feed, err := web.s.db.GetFeed(r.Context(), post.FeedID)
+	if err != nil {
+		web.internalError(w, r, fmt.Errorf("error getting feed: %v", err))
+		return
+	}
+	err = web.s.db.MarkPostRead(r.Context(), database.MarkPostReadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+		ReadAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		web.internalError(w, r, fmt.Errorf("error marking post read: %v", err))
+		return
+	}
+
+	date := post.CreatedAt
+	if post.PublishedAt.Valid {
+		date = post.PublishedAt.Time
+	}
+	body := post.Description.String
+	if post.ArticleContent.Valid {
+		body = post.ArticleContent.String
+	} else if post.Content.Valid {
+		body = post.Content.String
+	}
+	web.render(w, http.StatusOK, "post", map[string]any{
+		"User": user,
+		"Post": post,
+		"Feed": feed,
+		"Date": date,
+		// sanitized again in case it was stored before we sanitized posts
+		"Body": template.HTML(htmltext.Sanitize(body)),
+	})
+}
+
+func (web *webServer) handleMarkRead(w http.ResponseWriter, r *http.Request, user database.User) {
+	post, ok := web.postFromPath(w, r)
+	if !ok {
+		return
+	}
+	err := web.s.db.MarkPostRead(r.Context(), database.MarkPostReadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+		ReadAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		web.internalError(w, r, fmt.Errorf("error marking post read: %v", err))
+		return
+	}
+	http.Redirect(w, r, localRedirect(r.PostFormValue("next"), "/posts"), http.StatusSeeOther)
+}
+
+func (web *webServer) handleMarkUnread(w http.ResponseWriter, r *http.Request, user database.User) {
+	post, ok := web.postFromPath(w, r)
+	if !ok {
+		return
+	}
+	err := web.s.db.MarkPostUnread(r.Context(), database.MarkPostUnreadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	})
+	if err != nil {
+		web.internalError(w, r, fmt.Errorf("error marking post unread: %v", err))
+		return
+	}
+	http.Redirect(w, r, localRedirect(r.PostFormValue("next"), "/posts"), http.StatusSeeOther)
+}
+
+// Looks up the feed in the URL, showing an error page if there isn't one
+func (web *webServer) feedFromPath(w http.ResponseWriter, r *http.Request) (database.Feed, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		web.renderError(w, r, http.StatusNotFound, "Feed not found")
+		return database.Feed{}, false
+	}
+	feed, err := web.s.db.GetFeed(r.Context(), id)
+	if err == sql.ErrNoRows {
+		web.renderError(w, r, http.StatusNotFound, "Feed not found")
+		return database.Feed{}, false
+	} else if err != nil {
+		web.internalError(w, r, fmt.Errorf("error getting feed: %v", err))
+		return database.Feed{}, false
+	}
+	return feed, true
+}
+
+// Looks up the post in the URL, showing an error page if there isn't one
+func (web *webServer) postFromPath(w http.ResponseWriter, r *http.Request) (database.Post, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		web.renderError(w, r, http.StatusNotFound, "Post not found")
+		return database.Post{}, false
+	}
+	post, err := web.s.db.GetPost(r.Context(), id)
+	if err == sql.ErrNoRows {
+		web.renderError(w, r, http.StatusNotFound, "Post not found")
+		return database.Post{}, false
+	} else if err != nil {
+		web.internalError(w, r, fmt.Errorf("error getting post: %v", err))
+		return database.Post{}, false
+	}
+	return post, true
+}
+
+// Failed logins are free until there have been this many in a row, then
+// each one doubles the wait before the next attempt, up to the max
+const (
+	loginFreeFailures = 3
+	loginMaxBackoff   = 5 * time.Minute
+	// failures older than this are forgotten
+	loginFailureMemory = time.Hour
+)
+
+// Counts recent failed web logins by user name and by client address
+type loginThrottle struct {
+	mu       sync.Mutex
+	failures map[string]loginFailures
+}
+
+type loginFailures struct {
+	count int
+	last  time.Time
+}
+
+// How much longer any of the keys has to wait before trying again
+func (t *loginThrottle) wait(keys ...string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var wait time.Duration
+	for _, key := range keys {
+		f := t.failures[key]
+		if f.count < loginFreeFailures {
+			continue
+		}
+		// 2^16 seconds is already well past the max
+		backoff := min(time.Second<<min(f.count-loginFreeFailures, 16), loginMaxBackoff)
+		wait = max(wait, time.Until(f.last.Add(backoff)))
+	}
+	return wait
+}
+
+func (t *loginThrottle) fail(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for key, f := range t.failures {
+		if now.Sub(f.last) > loginFailureMemory {
+			delete(t.failures, key)
+		}
+	}
+	for _, key := range keys {
+		f := t.failures[key]
+		t.failures[key] = loginFailures{count: f.count + 1, last: now}
+	}
+}
+
+func (t *loginThrottle) reset(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		delete(t.failures, key)
+	}
+}
+
+// The client's IP address. Forwarding headers aren't trusted since anyone
+// can set them.
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
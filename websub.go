@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tepidmilk/gator/internal/database"
+)
+
+const (
+	// Lease we ask hubs for; they're free to grant a different one
+	websubLeaseRequest = 10 * 24 * time.Hour
+	// Renew active subscriptions this long before their lease runs out
+	websubRenewMargin = 24 * time.Hour
+	// Re-send subscription requests that were never verified after this long
+	websubPendingRetry = time.Hour
+	// Ask again this long after a hub denies a subscription
+	websubDeniedRetry = 24 * time.Hour
+	// How often the subscriber looks for subscriptions to (re)request
+	websubRenewInterval = 10 * time.Minute
+	// Largest content body we'll accept from a hub
+	websubMaxBody = 10 << 20
+	// Where the callback server listens unless the config says otherwise
+	defaultWebSubListenAddr = ":8080"
+)
+
+// The queries the subscriber runs, so it can be tested without a database
+type websubStore interface {
+	GetWebSubSubscription(ctx context.Context, id uuid.UUID) (database.WebsubSubscription, error)
+	GetWebSubSubscriptionsToRenew(ctx context.Context, arg database.GetWebSubSubscriptionsToRenewParams) ([]database.WebsubSubscription, error)
+	MarkWebSubRequested(ctx context.Context, arg database.MarkWebSubRequestedParams) error
+	ActivateWebSubSubscription(ctx context.Context, arg database.ActivateWebSubSubscriptionParams) error
+	SetWebSubState(ctx context.Context, arg database.SetWebSubStateParams) error
+	GetFeed(ctx context.Context, id uuid.UUID) (database.Feed, error)
+}
+
+// Subscribes to WebSub hubs on behalf of feeds and receives their pushes.
+// callbackBase is the public URL at which hubs can reach handler(), and
+// ingest stores the feeds hubs push to us.
+type websubSubscriber struct {
+	db           websubStore
+	ingest       func(database.Feed, *RSSFeed)
+	callbackBase string
+	client       *http.Client
+}
+
+func newWebSubSubscriber(s *state, callbackBase string) *websubSubscriber {
+	return &websubSubscriber{
+		db: s.db,
+		ingest: func(feed database.Feed, rss *RSSFeed) {
+			ingestFeed(s, feed, rss)
+		},
+		callbackBase: strings.TrimSuffix(callbackBase, "/"),
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Records the hub a feed advertises so the subscriber can subscribe to it.
+// The topic is the feed's rel="self" link, falling back to the URL we poll.
+func discoverHub(s *state, feed database.Feed, rss *RSSFeed) {
+	hub := rss.linkWithRel("hub")
+	if hub == "" {
+		return
+	}
+	topic := rss.linkWithRel("self")
+	if topic == "" {
+		topic = feed.Url
+	}
+
+	secret, err := randomSecret()
+	if err != nil {
+		log.Println("error generating websub secret:", err)
+		return
+	}
+	err = s.db.UpsertWebSubSubscription(context.Background(), database.UpsertWebSubSubscriptionParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		FeedID:    feed.ID,
+		HubUrl:    hub,
+		TopicUrl:  topic,
+		Secret:    secret,
+	})
+	if err != nil {
+		log.Println("error saving websub hub:", err)
+	}
+}
+
+// Reports whether a hub is currently pushing the feed's updates to us
+func websubActive(s *state, feedID uuid.UUID) bool {
+	sub, err := s.db.GetWebSubSubscriptionForFeed(context.Background(), feedID)
+	if err != nil {
+		return false
+	}
+	return sub.State == "active" && sub.LeaseExpiresAt.Valid && sub.LeaseExpiresAt.Time.After(time.Now().UTC())
+}
+
+func randomSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Runs the WebSub callback server and lease renewal alongside agg
+func startWebSub(s *state) {
+	addr := s.cfg.WebSubListenAddr
+	if addr == "" {
+		addr = defaultWebSubListenAddr
+	}
+	ws := newWebSubSubscriber(s, s.cfg.WebSubCallbackURL)
+
+	go func() {
+		fmt.Printf("Receiving WebSub pushes on %s at %s\n", addr, ws.callbackBase)
+		err := http.ListenAndServe(addr, ws.handler())
+		log.Println("websub callback server stopped:", err)
+	}()
+	go ws.renewLoop(context.Background())
+}
+
+func (ws *websubSubscriber) callbackURL(sub database.WebsubSubscription) string {
+	return ws.callbackBase + "/websub/" + sub.ID.String()
+}
+
+// Periodically sends subscription requests for newly discovered hubs,
+// retries unverified and denied requests and renews leases that are about
+// to expire
+func (ws *websubSubscriber) renewLoop(ctx context.Context) {
+	ticker := time.NewTicker(websubRenewInterval)
+	defer ticker.Stop()
+	for {
+		ws.renewSubscriptions(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (ws *websubSubscriber) renewSubscriptions(ctx context.Context) {
+	now := time.Now().UTC()
+	subs, err := ws.db.GetWebSubSubscriptionsToRenew(ctx, database.GetWebSubSubscriptionsToRenewParams{
+		RequestedAt:    sql.NullTime{Time: now.Add(-websubPendingRetry), Valid: true},
+		LeaseExpiresAt: sql.NullTime{Time: now.Add(websubRenewMargin), Valid: true},
+		UpdatedAt:      now.Add(-websubDeniedRetry),
+	})
+	if err != nil {
+		log.Println("error getting websub subscriptions to renew:", err)
+		return
+	}
+	for _, sub := range subs {
+		err := ws.subscribe(ctx, sub)
+		if err != nil {
+			log.Printf("error subscribing to %s at %s: %v", sub.TopicUrl, sub.HubUrl, err)
+		}
+	}
+}
+
+// Asks the hub to (re)subscribe us to the subscription's topic. The hub
+// confirms asynchronously by calling our callback with a challenge.
+func (ws *websubSubscriber) subscribe(ctx context.Context, sub database.WebsubSubscription) error {
+	form := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {sub.TopicUrl},
+		"hub.callback":      {ws.callbackURL(sub)},
+		"hub.secret":        {sub.Secret},
+		"hub.lease_seconds": {strconv.Itoa(int(websubLeaseRequest / time.Second))},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", sub.HubUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "gator")
+
+	res, err := ws.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("hub returned %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	return ws.db.MarkWebSubRequested(ctx, database.MarkWebSubRequestedParams{
+		RequestedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:          sub.ID,
+	})
+}
+
+// Serves the callback URL hubs use to verify subscriptions and push content
+func (ws *websubSubscriber) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /websub/{id}", ws.handleVerify)
+	mux.HandleFunc("POST /websub/{id}", ws.handleContent)
+	return mux
+}
+
+func (ws *websubSubscriber) subscriptionFromPath(r *http.Request) (database.WebsubSubscription, error) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return database.WebsubSubscription{}, err
+	}
+	return ws.db.GetWebSubSubscription(r.Context(), id)
+}
+
+// Answers a hub's intent verification (or denial) for a subscription
+func (ws *websubSubscriber) handleVerify(w http.ResponseWriter, r *http.Request) {
+	sub, err := ws.subscriptionFromPath(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("hub.topic") != sub.TopicUrl {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch query.Get("hub.mode") {
+	case "subscribe":
+		lease, err := strconv.Atoi(query.Get("hub.lease_seconds"))
+		if err != nil || lease <= 0 {
+			lease = int(websubLeaseRequest / time.Second)
+		}
+		err = ws.db.ActivateWebSubSubscription(r.Context(), database.ActivateWebSubSubscriptionParams{
+			LeaseExpiresAt: sql.NullTime{Time: time.Now().UTC().Add(time.Duration(lease) * time.Second), Valid: true},
+			UpdatedAt:      time.Now().UTC(),
+			ID:             sub.ID,
+		})
+		if err != nil {
+			log.Println("error activating websub subscription:", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("websub subscription to %s verified", sub.TopicUrl)
+	case "unsubscribe":
+		// we never ask to unsubscribe, so this didn't come from us
+		http.NotFound(w, r)
+		return
+	case "denied":
+		err = ws.db.SetWebSubState(r.Context(), database.SetWebSubStateParams{
+			State:     "denied",
+			UpdatedAt: time.Now().UTC(),
+			ID:        sub.ID,
+		})
+		if err != nil {
+			log.Println("error updating websub subscription:", err)
+		}
+		log.Printf("hub denied websub subscription to %s: %s", sub.TopicUrl, query.Get("hub.reason"))
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		http.Error(w, "unknown hub.mode", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, query.Get("hub.challenge"))
+}
+
+// Ingests content a hub pushed to us after checking its signature
+func (ws *websubSubscriber) handleContent(w http.ResponseWriter, r *http.Request) {
+	sub, err := ws.subscriptionFromPath(r)
+	if err != nil || sub.State != "active" {
+		// tells the hub to stop sending us this topic
+		http.Error(w, "unknown subscription", http.StatusGone)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, websubMaxBody))
+	if err != nil {
+		http.Error(w, "error reading body", http.StatusBadRequest)
+		return
+	}
+
+	// per the spec we acknowledge content with a bad signature but ignore it
+	w.WriteHeader(http.StatusAccepted)
+	err = verifyHubSignature(r.Header.Get("X-Hub-Signature"), sub.Secret, body)
+	if err != nil {
+		log.Printf("ignoring websub content for %s: %v", sub.TopicUrl, err)
+		return
+	}
+
+	feed, err := ws.db.GetFeed(context.Background(), sub.FeedID)
+	if err != nil {
+		log.Println("error getting feed for websub content:", err)
+		return
+	}
+	rss, err := parseFeed(body)
+	if err != nil {
+		log.Printf("error parsing websub content for %s: %v", feed.Name, err)
+		return
+	}
+	ws.ingest(feed, rss)
+}
+
+// Checks an X-Hub-Signature header of the form "method=hexdigest"
+func verifyHubSignature(header, secret string, body []byte) error {
+	method, signature, ok := strings.Cut(header, "=")
+	if !ok {
+		return errors.New("missing signature")
+	}
+
+	var h func() hash.Hash
+	switch strings.ToLower(method) {
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	case "sha384":
+		h = sha512.New384
+	case "sha512":
+		h = sha512.New
+	default:
+		return fmt.Errorf("unsupported signature method %q", method)
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("malformed signature: %v", err)
+	}
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
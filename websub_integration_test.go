@@ -0,0 +1,225 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tepidmilk/gator/internal/config"
+	"github.com/tepidmilk/gator/internal/database"
+)
+
+// These tests run against the Postgres database in GATOR_TEST_DB_URL:
+//
+//	GATOR_TEST_DB_URL=postgres://localhost:5432/gator_test?sslmode=disable go test -tags integration .
+//
+// Each test migrates a schema of its own and drops it afterwards.
+
+// Opens the test database with a freshly migrated schema
+func testDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	dbURL := os.Getenv("GATOR_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("GATOR_TEST_DB_URL isn't set")
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	schema := "gator_test_" + hex.EncodeToString(b)
+
+	admin, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	if strings.Contains(dbURL, "://") {
+		sep := "?"
+		if strings.Contains(dbURL, "?") {
+			sep = "&"
+		}
+		dbURL += sep + "search_path=" + schema
+	} else {
+		dbURL += " search_path=" + schema
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// the goose Up sections, in order
+	names, err := fs.Glob(schemaFiles, "sql/schema/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		migration, err := fs.ReadFile(schemaFiles, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up, _, _ := strings.Cut(string(migration), "-- +goose Down")
+		_, err = db.Exec(up)
+		if err != nil {
+			t.Fatalf("applying %s: %v", name, err)
+		}
+	}
+	return db
+}
+
+func TestWebSubPostgres(t *testing.T) {
+	db := testDatabase(t)
+	s := &state{db: database.New(db), conn: db, cfg: &config.Config{}}
+	ctx := context.Background()
+
+	var hubRequests atomic.Int32
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hubRequests.Add(1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer hub.Close()
+	// renewSubscriptions is synchronous, so the count is settled once it returns
+	renew := func(ws *websubSubscriber) int32 {
+		before := hubRequests.Load()
+		ws.renewSubscriptions(ctx)
+		return hubRequests.Load() - before
+	}
+
+	user, err := s.db.CreateUser(ctx, database.CreateUserParams{
+		ID: uuid.New(), CreatedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC(), Name: "websub",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, err := s.db.CreateFeed(ctx, database.CreateFeedParams{
+		ID: uuid.New(), CreatedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC(),
+		Name: "Example", Url: testTopic, UserID: user.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := newWebSubSubscriber(s, "https://gator.example.com")
+
+	// discovery
+	rss, err := parseFeed([]byte(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+  <channel>
+    <title>Example</title>
+    <atom:link rel="hub" href="` + hub.URL + `"/>
+    <atom:link rel="self" href="` + testTopic + `"/>
+  </channel>
+</rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	discoverHub(s, feed, rss)
+	sub, err := s.db.GetWebSubSubscriptionForFeed(ctx, feed.ID)
+	if err != nil {
+		t.Fatalf("hub wasn't discovered: %v", err)
+	}
+	if sub.HubUrl != hub.URL || sub.TopicUrl != testTopic || sub.State != "discovered" {
+		t.Fatalf("discovered %+v", sub)
+	}
+
+	// the first request is sent once and not again while it's pending
+	if n := renew(ws); n != 1 {
+		t.Fatalf("sent %d subscription requests, want 1", n)
+	}
+	if n := renew(ws); n != 0 {
+		t.Fatalf("re-sent a pending request %d times", n)
+	}
+
+	// the hub verifies with a lease short enough to be renewed right away
+	verify := url.Values{"hub.mode": {"subscribe"}, "hub.topic": {testTopic}, "hub.challenge": {"c"}, "hub.lease_seconds": {"60"}}
+	rec := httptest.NewRecorder()
+	ws.handler().ServeHTTP(rec, httptest.NewRequest("GET", "/websub/"+sub.ID.String()+"?"+verify.Encode(), nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "c" {
+		t.Fatalf("verification answered %d %q", rec.Code, rec.Body.String())
+	}
+
+	// a renewal goes out, and isn't re-sent while the hub hasn't answered
+	_, err = db.Exec("UPDATE websub_subscriptions SET requested_at = requested_at - interval '2 hours'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := renew(ws); n != 1 {
+		t.Fatalf("sent %d renewals, want 1", n)
+	}
+	if n := renew(ws); n != 0 {
+		t.Fatalf("re-sent an unanswered renewal %d times", n)
+	}
+
+	// a signed push is stored, a forged one isn't
+	const content = `<?xml version="1.0"?>
+<rss version="2.0">
+  <channel>
+    <title>Example</title>
+    <item>
+      <title>%s</title>
+      <link>https://example.com/%s</link>
+      <pubDate>Mon, 19 Oct 2026 10:00:00 +0000</pubDate>
+    </item>
+  </channel>
+</rss>`
+	push := func(title, secret string) {
+		body := fmt.Sprintf(content, title, title)
+		req := httptest.NewRequest("POST", "/websub/"+sub.ID.String(), strings.NewReader(body))
+		req.Header.Set("X-Hub-Signature", testSignature(secret, body))
+		rec := httptest.NewRecorder()
+		ws.handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("push answered %d", rec.Code)
+		}
+	}
+	postCount := func(title string) int {
+		var n int
+		err := db.QueryRow("SELECT COUNT(*) FROM posts WHERE feed_id = $1 AND title = $2", feed.ID, title).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	push("pushed", sub.Secret)
+	if postCount("pushed") != 1 {
+		t.Error("signed push wasn't stored")
+	}
+	push("forged", "wrong secret")
+	if postCount("forged") != 0 {
+		t.Error("push with a bad signature was stored")
+	}
+
+	// a denial is retried, but only after a while
+	_, err = db.Exec("UPDATE websub_subscriptions SET state = 'denied', updated_at = $1", time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := renew(ws); n != 0 {
+		t.Fatalf("retried a fresh denial %d times", n)
+	}
+	_, err = db.Exec("UPDATE websub_subscriptions SET updated_at = $1", time.Now().UTC().Add(-websubDeniedRetry-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := renew(ws); n != 1 {
+		t.Fatalf("sent %d requests after an old denial, want 1", n)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tepidmilk/gator/internal/database"
+)
+
+const testTopic = "https://example.com/feed.xml"
+
+// Holds subscriptions in memory and records what the subscriber did to
+// them. toRenew is returned as is: which subscriptions are due is up to
+// the SQL, which websub_integration_test.go covers.
+type fakeWebSubStore struct {
+	subs      map[uuid.UUID]*database.WebsubSubscription
+	feeds     map[uuid.UUID]database.Feed
+	toRenew   []database.WebsubSubscription
+	requested []uuid.UUID
+}
+
+func newFakeWebSubStore() *fakeWebSubStore {
+	return &fakeWebSubStore{
+		subs:  make(map[uuid.UUID]*database.WebsubSubscription),
+		feeds: make(map[uuid.UUID]database.Feed),
+	}
+}
+
+// Adds a feed and a subscription to it in the given state
+func (f *fakeWebSubStore) add(state string) database.WebsubSubscription {
+	feed := database.Feed{ID: uuid.New(), Name: "Example", Url: testTopic}
+	f.feeds[feed.ID] = feed
+	sub := database.WebsubSubscription{
+		ID:       uuid.New(),
+		FeedID:   feed.ID,
+		HubUrl:   "https://hub.example.com/",
+		TopicUrl: testTopic,
+		Secret:   "secret",
+		State:    state,
+	}
+	f.subs[sub.ID] = &sub
+	return sub
+}
+
+func (f *fakeWebSubStore) GetWebSubSubscription(ctx context.Context, id uuid.UUID) (database.WebsubSubscription, error) {
+	sub, ok := f.subs[id]
+	if !ok {
+		return database.WebsubSubscription{}, sql.ErrNoRows
+	}
+	return *sub, nil
+}
+
+func (f *fakeWebSubStore) GetWebSubSubscriptionsToRenew(ctx context.Context, arg database.GetWebSubSubscriptionsToRenewParams) ([]database.WebsubSubscription, error) {
+	return f.toRenew, nil
+}
+
+func (f *fakeWebSubStore) MarkWebSubRequested(ctx context.Context, arg database.MarkWebSubRequestedParams) error {
+	f.requested = append(f.requested, arg.ID)
+	return nil
+}
+
+func (f *fakeWebSubStore) ActivateWebSubSubscription(ctx context.Context, arg database.ActivateWebSubSubscriptionParams) error {
+	f.subs[arg.ID].State = "active"
+	f.subs[arg.ID].LeaseExpiresAt = arg.LeaseExpiresAt
+	return nil
+}
+
+func (f *fakeWebSubStore) SetWebSubState(ctx context.Context, arg database.SetWebSubStateParams) error {
+	f.subs[arg.ID].State = arg.State
+	return nil
+}
+
+func (f *fakeWebSubStore) GetFeed(ctx context.Context, id uuid.UUID) (database.Feed, error) {
+	feed, ok := f.feeds[id]
+	if !ok {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	return feed, nil
+}
+
+// A subscriber backed by store that records the feeds it would ingest
+func newTestSubscriber(store *fakeWebSubStore) (*websubSubscriber, *[]*RSSFeed) {
+	var ingested []*RSSFeed
+	ws := &websubSubscriber{
+		db: store,
+		ingest: func(feed database.Feed, rss *RSSFeed) {
+			ingested = append(ingested, rss)
+		},
+		callbackBase: "https://gator.example.com",
+		client:       http.DefaultClient,
+	}
+	return ws, &ingested
+}
+
+func TestWebSubSubscribe(t *testing.T) {
+	var form url.Values
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer hub.Close()
+
+	store := newFakeWebSubStore()
+	sub := store.add("discovered")
+	sub.HubUrl = hub.URL
+	store.toRenew = []database.WebsubSubscription{sub}
+	ws, _ := newTestSubscriber(store)
+
+	ws.renewSubscriptions(context.Background())
+	if form == nil {
+		t.Fatal("hub never got a subscription request")
+	}
+	want := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {testTopic},
+		"hub.callback":      {"https://gator.example.com/websub/" + sub.ID.String()},
+		"hub.secret":        {"secret"},
+		"hub.lease_seconds": {fmt.Sprint(int(websubLeaseRequest / time.Second))},
+	}
+	if form.Encode() != want.Encode() {
+		t.Errorf("hub got %v, want %v", form, want)
+	}
+	if len(store.requested) != 1 || store.requested[0] != sub.ID {
+		t.Errorf("requested %v, want %v", store.requested, sub.ID)
+	}
+}
+
+func TestWebSubSubscribeRejected(t *testing.T) {
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusBadRequest)
+	}))
+	defer hub.Close()
+
+	store := newFakeWebSubStore()
+	sub := store.add("discovered")
+	sub.HubUrl = hub.URL
+	store.toRenew = []database.WebsubSubscription{sub}
+	ws, _ := newTestSubscriber(store)
+
+	ws.renewSubscriptions(context.Background())
+	if len(store.requested) != 0 {
+		t.Errorf("request the hub refused was marked as sent")
+	}
+}
+
+func TestWebSubVerify(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantStatus int
+		wantBody   string
+		wantState  string
+	}{
+		{
+			name:       "subscribe",
+			query:      url.Values{"hub.mode": {"subscribe"}, "hub.topic": {testTopic}, "hub.challenge": {"challenge-123"}, "hub.lease_seconds": {"3600"}},
+			wantStatus: http.StatusOK,
+			wantBody:   "challenge-123",
+			wantState:  "active",
+		},
+		{
+			name:       "wrong topic",
+			query:      url.Values{"hub.mode": {"subscribe"}, "hub.topic": {"https://example.com/other.xml"}, "hub.challenge": {"x"}},
+			wantStatus: http.StatusNotFound,
+			wantState:  "pending",
+		},
+		{
+			name:       "unsolicited unsubscribe",
+			query:      url.Values{"hub.mode": {"unsubscribe"}, "hub.topic": {testTopic}, "hub.challenge": {"x"}},
+			wantStatus: http.StatusNotFound,
+			wantState:  "pending",
+		},
+		{
+			name:       "denied",
+			query:      url.Values{"hub.mode": {"denied"}, "hub.topic": {testTopic}, "hub.reason": {"nope"}},
+			wantStatus: http.StatusOK,
+			wantState:  "denied",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeWebSubStore()
+			sub := store.add("pending")
+			ws, _ := newTestSubscriber(store)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/websub/"+sub.ID.String()+"?"+tt.query.Encode(), nil)
+			ws.handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if state := store.subs[sub.ID].State; state != tt.wantState {
+				t.Errorf("state %q, want %q", state, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestWebSubContent(t *testing.T) {
+	content := `<?xml version="1.0"?>
+<rss version="2.0">
+  <channel>
+    <title>Example</title>
+    <item>
+      <title>Pushed post</title>
+      <link>https://example.com/pushed</link>
+      <pubDate>Mon, 19 Oct 2026 10:00:00 +0000</pubDate>
+    </item>
+  </channel>
+</rss>`
+
+	tests := []struct {
+		name         string
+		state        string
+		signature    string
+		wantStatus   int
+		wantIngested bool
+	}{
+		{"signed", "active", testSignature("secret", content), http.StatusAccepted, true},
+		{"wrong secret", "active", testSignature("wrong secret", content), http.StatusAccepted, false},
+		{"unsigned", "active", "", http.StatusAccepted, false},
+		{"inactive", "pending", testSignature("secret", content), http.StatusGone, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeWebSubStore()
+			sub := store.add(tt.state)
+			ws, ingested := newTestSubscriber(store)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/websub/"+sub.ID.String(), strings.NewReader(content))
+			req.Header.Set("X-Hub-Signature", tt.signature)
+			ws.handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if !tt.wantIngested {
+				if len(*ingested) != 0 {
+					t.Error("content was ingested")
+				}
+				return
+			}
+			if len(*ingested) != 1 {
+				t.Fatalf("ingested %d feeds, want 1", len(*ingested))
+			}
+			items := (*ingested)[0].Channel.Item
+			if len(items) != 1 || items[0].Title != "Pushed post" {
+				t.Errorf("ingested %+v, want the pushed post", items)
+			}
+		})
+	}
+}
+
+func testSignature(secret, content string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(content))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}